@@ -0,0 +1,243 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alex-appy-love-story/worker-template/bulkhead"
+	"github.com/alex-appy-love-story/worker-template/circuitbreaker"
+)
+
+// Health is the output of GET /health.
+type Health struct {
+	Status    string                         `json:"status"` // "ok", or "degraded" while a breaker isn't closed or a bulkhead is full.
+	Queue     string                         `json:"queue"`
+	Breakers  []circuitbreaker.BreakerHealth `json:"breakers"`
+	Bulkheads []bulkhead.Stats               `json:"bulkheads"`
+}
+
+// ForceRequest is the body of PUT /breakers/<name>/force.
+type ForceRequest struct {
+	State  string `json:"state"`
+	Reason string `json:"reason"`
+	TTL    string `json:"ttl"` // Go duration, such as "30m".
+}
+
+func (a *App) Health() Health {
+	health := Health{
+		Status:    "ok",
+		Queue:     a.Config.QueueConfig.Server,
+		Breakers:  a.Breakers.Health(),
+		Bulkheads: a.Bulkheads.Stats(),
+	}
+
+	for _, b := range health.Breakers {
+		if b.State != "closed" {
+			health.Status = "degraded"
+		}
+	}
+
+	for _, b := range health.Bulkheads {
+		if b.Waiting > 0 {
+			health.Status = "degraded"
+		}
+	}
+
+	return health
+}
+
+// serveAdmin serves the admin endpoints until the context is done:
+//
+//	GET    /health
+//	PUT    /breakers/<name>/force
+//	DELETE /breakers/<name>/force
+//
+// The overrides need "Authorization: Bearer <ADMIN_TOKEN>", or come from this
+// host if no token is set.
+func (a *App) serveAdmin(ctx context.Context) {
+	if len(a.Config.AdminAddr) == 0 {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", a.handleHealth)
+	mux.HandleFunc("/breakers/", a.authorize(a.handleForce))
+
+	server := &http.Server{Addr: a.Config.AdminAddr, Handler: mux}
+
+	go func() {
+		log.Println("Admin listening on", a.Config.AdminAddr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Println("Admin server failed:", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+}
+
+func (a *App) authorize(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(a.Config.AdminToken) > 0 {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(a.Config.AdminToken)) != 1 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err != nil || !net.ParseIP(host).IsLoopback() {
+			http.Error(w, "Forbidden, set ADMIN_TOKEN to force the breakers remotely", http.StatusForbidden)
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+func (a *App) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Health())
+}
+
+func (a *App) handleForce(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/breakers/")
+	if !strings.HasSuffix(name, "/force") {
+		http.NotFound(w, r)
+		return
+	}
+	name = strings.TrimSuffix(name, "/force")
+	if len(name) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req ForceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Malformed request: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := a.forceBreaker(r.Context(), name, req.State, req.TTL, req.Reason); err != nil {
+			http.Error(w, err.Error(), errorStatus(err, http.StatusBadRequest))
+			return
+		}
+
+	case http.MethodDelete:
+		if err := a.Breakers.Clear(r.Context(), name); err != nil {
+			http.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+			return
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Printf("Circuit breaker %s override changed by %s\n", name, r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// errorStatus is 404 for an unknown breaker, status otherwise.
+func errorStatus(err error, status int) int {
+	if errors.Is(err, circuitbreaker.ErrUnknownBreaker) {
+		return http.StatusNotFound
+	}
+	return status
+}
+
+func (a *App) forceBreaker(ctx context.Context, name string, state string, ttl string, reason string) error {
+	s, ok := circuitbreaker.StringToState(state)
+	if !ok {
+		return fmt.Errorf("Unknown state: %s", state)
+	}
+
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return fmt.Errorf("Invalid ttl: %w", err)
+	}
+
+	o, err := circuitbreaker.NewOverride(s, reason, d)
+	if err != nil {
+		return err
+	}
+
+	return a.Breakers.Force(ctx, name, o)
+}
+
+// BreakerCommand is the operator command to force the circuit breakers of
+// every replica, during a planned maintenance or after a fix.
+//
+//	breakers list
+//	breakers force <name> <open|closed> <ttl> [reason]
+//	breakers clear <name>
+func (a *App) BreakerCommand(args []string) error {
+	ctx := context.Background()
+
+	command := "list"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "list":
+		forced, err := a.Breakers.Overrides(ctx)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(forced))
+		for name := range forced {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			o := forced[name]
+			fmt.Printf("%s\t%s\tuntil: %s\treason: %s\n", name, o.State, o.Until.Format(time.RFC3339), o.Reason)
+		}
+		return nil
+
+	case "force":
+		if len(args) < 4 {
+			return fmt.Errorf("Usage: breakers force <name> <open|closed> <ttl> [reason]")
+		}
+		reason := strings.Join(args[4:], " ")
+		if err := a.forceBreaker(ctx, args[1], args[2], args[3], reason); err != nil {
+			return err
+		}
+		fmt.Printf("Forced %s %s for %s\n", args[1], args[2], args[3])
+		return nil
+
+	case "clear":
+		if len(args) < 2 {
+			return fmt.Errorf("Usage: breakers clear <name>")
+		}
+		if err := a.Breakers.Clear(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Println("Cleared", args[1])
+		return nil
+
+	default:
+		return fmt.Errorf("Unknown breakers command: %s", command)
+	}
+}
@@ -8,9 +8,14 @@ import (
 	"os"
 	"os/signal"
 
+	"github.com/alex-appy-love-story/worker-template/bulkhead"
 	"github.com/alex-appy-love-story/worker-template/circuitbreaker"
+	"github.com/alex-appy-love-story/worker-template/events"
+	"github.com/alex-appy-love-story/worker-template/ordersvc"
 	"github.com/alex-appy-love-story/worker-template/tasks"
+	"github.com/alex-appy-love-story/worker-template/webhooks"
 	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 
@@ -23,8 +28,13 @@ type App struct {
 	Config         Config
 	AsynqClient    *asynq.Client
 	AsynqInspector *asynq.Inspector
+	RedisClient    *redis.Client
+	OrderClient    ordersvc.OrderClient
+	EventPublisher *events.Publisher
+	Webhooks       *webhooks.Dispatcher
 	DBClient       *gorm.DB
-	CircuitBreaker *circuitbreaker.CB
+	Breakers       *circuitbreaker.Registry
+	Bulkheads      *bulkhead.Registry
 }
 
 func New(config Config) *App {
@@ -38,9 +48,63 @@ func New(config Config) *App {
 		Config:         config,
 		AsynqClient:    asynq.NewClient(asynqConnection),
 		AsynqInspector: asynq.NewInspector(asynqConnection),
-		CircuitBreaker: circuitbreaker.NewCircuitBreaker(),
+		RedisClient:    redis.NewClient(&redis.Options{Addr: config.RedisAddress}),
 	}
 
+	breakerOptions := circuitbreaker.CBOptions{
+		OpenIntervalMultiplier: circuitbreaker.FloatToPointer(config.BreakerOpenIntervalMultiplier),
+		MaxOpenInterval:        circuitbreaker.TimeToPointer(config.BreakerMaxOpenInterval),
+		OpenIntervalJitter:     circuitbreaker.FloatToPointer(config.BreakerOpenIntervalJitter),
+		OnStateChange: func(name string, t circuitbreaker.Transition) {
+			log.Printf("Circuit breaker %s: %s -> %s\n", name, t.From, t.To)
+		},
+	}
+	// NOTE(Appy): Overrides are always shared, an operator forces every replica.
+	breakerStore := circuitbreaker.NewRedisStore(app.RedisClient)
+	breakerOptions.Overrides = breakerStore
+	if config.SharedBreakers {
+		breakerOptions.Store = breakerStore
+	}
+	app.Breakers = circuitbreaker.NewRegistry(breakerOptions)
+
+	// NOTE(Appy): Only these can be forced, a typo must not create a breaker.
+	app.Breakers.Declare(circuitbreaker.DATABASE, circuitbreaker.ORDER_SERVICE)
+	for _, queue := range append([]string{config.QueueConfig.Next}, config.QueueConfig.NextQueues...) {
+		if len(queue) > 0 {
+			app.Breakers.Declare(circuitbreaker.QueueBreaker(queue))
+		}
+	}
+
+	// NOTE(Appy): Always leave a worker for the other dependencies.
+	bulkheadLimit := config.WorkerCount - 1
+	if bulkheadLimit < 1 {
+		bulkheadLimit = 1
+	}
+	app.Bulkheads = bulkhead.NewRegistry(bulkhead.Options{
+		MaxConcurrent: bulkhead.IntToPointer(bulkheadLimit),
+		QueueTimeout:  bulkhead.TimeToPointer(config.BulkheadQueueTimeout),
+	})
+	for name, limit := range config.BulkheadLimits {
+		app.Bulkheads.Configure(name, bulkhead.Options{
+			MaxConcurrent: bulkhead.IntToPointer(limit),
+			QueueTimeout:  bulkhead.TimeToPointer(config.BulkheadQueueTimeout),
+		})
+	}
+
+	orderClient, err := ordersvc.New(config.OrderSvcTransport, config.OrderSvcAddr, ordersvc.Options{
+		Timeout:     config.OrderSvcTimeout,
+		MaxAttempts: config.OrderSvcMaxAttempts,
+		Queue:       config.OrderStatusQueue,
+		AsynqClient: app.AsynqClient,
+		RedisClient: app.RedisClient,
+	})
+	if err != nil {
+		log.Fatalln("Failed to create order client:", err)
+	}
+	orderClient = ordersvc.WithBreaker(orderClient, app.Breakers.Get(circuitbreaker.ORDER_SERVICE))
+	app.OrderClient = ordersvc.WithBulkhead(orderClient, app.Bulkheads.Get(bulkhead.ORDER_SERVICE))
+	app.EventPublisher = events.NewPublisher(app.RedisClient, config.EventStream)
+
 	return app
 }
 
@@ -88,21 +152,42 @@ func (a *App) Start(ctx context.Context) error {
 	server := asynq.NewServer(
 		asynq.RedisClientOpt{Addr: a.Config.RedisAddress},
 		asynq.Config{
-			Concurrency: 5,
+			Concurrency: a.Config.WorkerCount,
 			Queues: map[string]int{
-				a.Config.QueueConfig.Server: 10,
+				a.Config.QueueConfig.Server:   10,
+				a.Config.QueueConfig.Webhooks: 1,
 			},
 
+			// Compensations back off exponentially and are dead-lettered once exhausted.
+			// Expired sagas dropped by asynq are compensated as well.
+			RetryDelayFunc: tasks.RetryDelay,
+			ErrorHandler:   asynq.ErrorHandlerFunc(tasks.HandleTaskError),
+
 			BaseContext: func() context.Context {
 				baseContext := context.Background()
 				baseContext = context.WithValue(baseContext, "asynq_client", a.AsynqClient)
 				baseContext = context.WithValue(baseContext, "db_client", a.DBClient)
 				baseContext = context.WithValue(baseContext, "next_queue", a.Config.QueueConfig.Next)
+				baseContext = context.WithValue(baseContext, "next_queues", a.Config.QueueConfig.NextQueues)
 				baseContext = context.WithValue(baseContext, "server_queue", a.Config.QueueConfig.Server)
 				baseContext = context.WithValue(baseContext, "asynq_inspector", a.AsynqInspector)
+				baseContext = context.WithValue(baseContext, "redis_client", a.RedisClient)
 				baseContext = context.WithValue(baseContext, "previous_queue", a.Config.QueueConfig.Previous)
-				baseContext = context.WithValue(baseContext, "circuit_breaker", a.CircuitBreaker)
-				baseContext = context.WithValue(baseContext, "order_svc_addr", a.Config.OrderSvcAddr)
+				baseContext = context.WithValue(baseContext, "circuit_breakers", a.Breakers)
+				baseContext = context.WithValue(baseContext, "bulkheads", a.Bulkheads)
+				baseContext = context.WithValue(baseContext, "circuit_fallback", a.Config.CircuitFallback)
+				baseContext = context.WithValue(baseContext, "order_client", a.OrderClient)
+				baseContext = context.WithValue(baseContext, "event_publisher", a.EventPublisher)
+				if a.Webhooks != nil {
+					baseContext = context.WithValue(baseContext, "webhook_dispatcher", a.Webhooks)
+				}
+				baseContext = context.WithValue(baseContext, "content_type", a.Config.ContentType)
+				baseContext = context.WithValue(baseContext, "schema_version", a.Config.SchemaVersion)
+				baseContext = context.WithValue(baseContext, "dead_letter_queue", a.Config.QueueConfig.DeadLetter)
+				baseContext = context.WithValue(baseContext, "saga_timeout", a.Config.SagaTimeout)
+				if a.Config.ChaosSpec != nil {
+					baseContext = context.WithValue(baseContext, "chaos_spec", a.Config.ChaosSpec)
+				}
 				return baseContext
 			},
 		},
@@ -125,6 +210,14 @@ func (a *App) Start(ctx context.Context) error {
 			return err
 		}
 
+		if err := db.InitTables(a.DBClient, &tasks.Charge{}); err != nil {
+			return err
+		}
+
+		if err := a.initWebhooks(); err != nil {
+			return err
+		}
+
 		if !migrator.HasTable(&token.Token{}) {
 			a.DBClient.Transaction(func(tsx *gorm.DB) error {
 				if err := db.InitTables(tsx, &token.Token{}); err != nil {
@@ -142,21 +235,42 @@ func (a *App) Start(ctx context.Context) error {
 	}
 
 	defer func() {
+		if err := a.OrderClient.Close(); err != nil {
+			fmt.Println("Failed to close order client", err)
+		}
 		if err := a.AsynqClient.Close(); err != nil {
 			fmt.Println("Failed to close redis", err)
 		}
+		if err := a.RedisClient.Close(); err != nil {
+			fmt.Println("Failed to close redis", err)
+		}
 	}()
 
 	fmt.Println("Starting server...")
 
-	ch := make(chan error, 1)
-
 	mux := asynq.NewServeMux()
 
 	mux.Use(tasks.LoggingMiddleware)
-	mux.Use(tasks.CircuitBreakerMiddleware)
 
-	tasks.RegisterTopic(mux)
+	// NOTE(Appy): Only the steps go through the database breaker, a failing
+	// webhook endpoint must not open it.
+	steps := asynq.NewServeMux()
+	steps.Use(tasks.CircuitBreakerMiddleware)
+	tasks.RegisterTopic(steps)
+	mux.Handle("task:", steps)
+
+	if a.Webhooks != nil {
+		a.Webhooks.RegisterTopic(mux)
+	}
+
+	return a.serve(ctx, server, mux)
+}
+
+// serve runs the asynq server until it fails or the context is done.
+func (a *App) serve(ctx context.Context, server *asynq.Server, mux *asynq.ServeMux) error {
+	a.serveAdmin(ctx)
+
+	ch := make(chan error, 1)
 
 	go func() {
 		err := server.Run(mux)
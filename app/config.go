@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex-appy-love-story/worker-template/tasks"
 )
 
 type DatabaseConfig struct {
@@ -20,6 +24,67 @@ type Config struct {
 	WorkerCount    int
 	OrderSvcAddr   string
 	OtelConfig     OtelConfig
+
+	// OrderSvcTransport is either "http", "grpc" or "queue".
+	OrderSvcTransport string
+	// OrderStatusQueue receives the status updates of the "queue" transport.
+	OrderStatusQueue string
+	// Timeout of a single request to the order service, and how many are sent.
+	OrderSvcTimeout     time.Duration
+	OrderSvcMaxAttempts int
+
+	// ContentType of the task payloads sent by this service,
+	// tasks.CONTENT_TYPE_JSON or tasks.CONTENT_TYPE_PROTOBUF.
+	ContentType string
+
+	// SchemaVersion of the task payloads sent by this service, tasks.SCHEMA_V0
+	// by default. Raise it with SCHEMA_WRITE_VERSION once every step and the
+	// orchestrator run a decoder of the new version, never before. Protobuf
+	// payloads need tasks.SCHEMA_V1, v0 is always json.
+	SchemaVersion int
+
+	// SagaTimeout is the end-to-end deadline of a saga started by this service,
+	// 0 (the default) for none. Set SAGA_TIMEOUT to opt in.
+	SagaTimeout time.Duration
+
+	// EventStream receives the payment events.
+	EventStream string
+
+	// ChaosSpec injects faults into every saga handled by this service.
+	ChaosSpec *tasks.ChaosSpec
+
+	// SharedBreakers keeps the circuit breakers in Redis, shared by every replica.
+	SharedBreakers bool
+
+	// Back-off of the open interval of the breakers: every open period in a row
+	// multiplies it, up to BreakerMaxOpenInterval, and the jitter shortens it by
+	// up to this fraction. 1 and 0 turn them off.
+	BreakerOpenIntervalMultiplier float64
+	BreakerMaxOpenInterval        time.Duration
+	BreakerOpenIntervalJitter     float64
+
+	// AdminAddr serves the health output and the breaker overrides, disabled if empty.
+	AdminAddr string
+	// AdminToken is the bearer token of the breaker overrides, only served to
+	// this host if empty.
+	AdminToken string
+
+	// BulkheadLimits caps the calls in flight per dependency, the ones not set
+	// get WorkerCount - 1. Calls over the limit wait up to BulkheadQueueTimeout.
+	BulkheadLimits       map[string]int
+	BulkheadQueueTimeout time.Duration
+
+	// CircuitFallback is what happens to a task rejected by a breaker: "reject",
+	// "defer" or "degrade".
+	CircuitFallback string
+
+	OrchestratorConfig OrchestratorConfig
+}
+
+type OrchestratorConfig struct {
+	Steps       []string
+	StepTimeout time.Duration
+	MaxAttempts int
 }
 
 type OtelConfig struct {
@@ -28,9 +93,15 @@ type OtelConfig struct {
 }
 
 type QueueConfig struct {
-	Server   string
-	Next     string
-	Previous string
+	Server string
+	Next   string
+	// NextQueues holds every next queue when the step fans out, Next is the first one.
+	NextQueues []string
+	Previous   string
+	// DeadLetter holds the compensations which exhausted their retries.
+	DeadLetter string
+	// Webhooks holds the webhook deliveries, served next to Server.
+	Webhooks string
 }
 
 // Required Configs:
@@ -39,6 +110,11 @@ type QueueConfig struct {
 // - DB_USER
 // - DB_PASSWORD
 // - WORKER_COUNT
+//
+// Orchestrator Configs (SERVER_QUEUE_NAME is the orchestrator queue):
+// - ORCHESTRATOR_STEPS (comma separated step queues, in order)
+// - ORCHESTRATOR_STEP_TIMEOUT
+// - ORCHESTRATOR_MAX_ATTEMPTS
 func LoadConfig() (*Config, error) {
 	cfg := &Config{
 		RedisAddress: "localhost:6379",
@@ -47,12 +123,28 @@ func LoadConfig() (*Config, error) {
 			Password: "password",
 			Address:  "localhost:3306",
 		},
-		OrderSvcAddr: "localhost:5001",
-		WorkerCount:  5,
+		OrderSvcAddr:                  "localhost:5001",
+		OrderSvcTransport:             "http",
+		OrderStatusQueue:              "order_status",
+		OrderSvcTimeout:               5 * time.Second,
+		OrderSvcMaxAttempts:           3,
+		ContentType:                   tasks.CONTENT_TYPE_JSON,
+		SchemaVersion:                 tasks.SCHEMA_V0,
+		EventStream:                   "payments",
+		CircuitFallback:               "reject",
+		BreakerOpenIntervalMultiplier: 1,
+		BreakerMaxOpenInterval:        2 * time.Minute,
+		BreakerOpenIntervalJitter:     0,
+		BulkheadQueueTimeout:          time.Second,
+		WorkerCount:                   5,
 		OtelConfig: OtelConfig{
 			ExporterEndpoint: "localhost:4317",
 			Insecure:         "true",
 		},
+		OrchestratorConfig: OrchestratorConfig{
+			StepTimeout: 10 * time.Second,
+			MaxAttempts: 3,
+		},
 	}
 
 	if redisAddr, exists := os.LookupEnv("REDIS_ADDR"); exists {
@@ -63,6 +155,26 @@ func LoadConfig() (*Config, error) {
 		cfg.OrderSvcAddr = orderSvcAddr
 	}
 
+	if orderSvcTransport, exists := os.LookupEnv("ORDER_SVC_TRANSPORT"); exists {
+		cfg.OrderSvcTransport = orderSvcTransport
+	}
+
+	if orderStatusQueue, exists := os.LookupEnv("ORDER_STATUS_QUEUE"); exists {
+		cfg.OrderStatusQueue = orderStatusQueue
+	}
+
+	if orderSvcTimeout, exists := os.LookupEnv("ORDER_SVC_TIMEOUT"); exists {
+		if val, err := time.ParseDuration(orderSvcTimeout); err == nil {
+			cfg.OrderSvcTimeout = val
+		}
+	}
+
+	if orderSvcMaxAttempts, exists := os.LookupEnv("ORDER_SVC_MAX_ATTEMPTS"); exists {
+		if val, err := strconv.Atoi(orderSvcMaxAttempts); err == nil {
+			cfg.OrderSvcMaxAttempts = val
+		}
+	}
+
 	if dbAddress, exists := os.LookupEnv("DB_ADDRESS"); exists {
 		cfg.DatabaseConfig.Address = dbAddress
 	}
@@ -83,6 +195,99 @@ func LoadConfig() (*Config, error) {
 		cfg.OtelConfig.ExporterEndpoint = otelExporter
 	}
 
+	if contentType, exists := os.LookupEnv("PAYLOAD_CONTENT_TYPE"); exists {
+		if contentType != tasks.CONTENT_TYPE_JSON && contentType != tasks.CONTENT_TYPE_PROTOBUF {
+			return nil, fmt.Errorf("Invalid env 'PAYLOAD_CONTENT_TYPE': %s", contentType)
+		}
+		cfg.ContentType = contentType
+	}
+
+	if schemaVersion, exists := os.LookupEnv("SCHEMA_WRITE_VERSION"); exists {
+		val, err := strconv.Atoi(schemaVersion)
+		if err != nil || val < tasks.SCHEMA_V0 || val > tasks.SCHEMA_VERSION {
+			return nil, fmt.Errorf("Invalid env 'SCHEMA_WRITE_VERSION': %s", schemaVersion)
+		}
+		cfg.SchemaVersion = val
+	}
+
+	if sagaTimeout, exists := os.LookupEnv("SAGA_TIMEOUT"); exists {
+		if val, err := time.ParseDuration(sagaTimeout); err == nil {
+			cfg.SagaTimeout = val
+		}
+	}
+
+	if eventStream, exists := os.LookupEnv("PAYMENT_EVENTS_STREAM"); exists {
+		cfg.EventStream = eventStream
+	}
+
+	if chaosSpec, exists := os.LookupEnv("CHAOS_SPEC"); exists {
+		spec, err := tasks.LoadChaosSpec(chaosSpec)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid env 'CHAOS_SPEC': %w", err)
+		}
+		cfg.ChaosSpec = spec
+	}
+
+	if sharedBreakers, exists := os.LookupEnv("CIRCUIT_BREAKER_SHARED"); exists {
+		if val, err := strconv.ParseBool(sharedBreakers); err == nil {
+			cfg.SharedBreakers = val
+		}
+	}
+
+	if multiplier, exists := os.LookupEnv("CIRCUIT_BREAKER_OPEN_INTERVAL_MULTIPLIER"); exists {
+		val, err := strconv.ParseFloat(multiplier, 64)
+		if err != nil || val < 1 {
+			return nil, fmt.Errorf("Invalid env 'CIRCUIT_BREAKER_OPEN_INTERVAL_MULTIPLIER': %s", multiplier)
+		}
+		cfg.BreakerOpenIntervalMultiplier = val
+	}
+
+	if maxOpenInterval, exists := os.LookupEnv("CIRCUIT_BREAKER_MAX_OPEN_INTERVAL"); exists {
+		val, err := time.ParseDuration(maxOpenInterval)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("Invalid env 'CIRCUIT_BREAKER_MAX_OPEN_INTERVAL': %s", maxOpenInterval)
+		}
+		cfg.BreakerMaxOpenInterval = val
+	}
+
+	if jitter, exists := os.LookupEnv("CIRCUIT_BREAKER_OPEN_INTERVAL_JITTER"); exists {
+		val, err := strconv.ParseFloat(jitter, 64)
+		if err != nil || val < 0 || val >= 1 {
+			return nil, fmt.Errorf("Invalid env 'CIRCUIT_BREAKER_OPEN_INTERVAL_JITTER': %s", jitter)
+		}
+		cfg.BreakerOpenIntervalJitter = val
+	}
+
+	if adminAddr, exists := os.LookupEnv("ADMIN_ADDR"); exists {
+		cfg.AdminAddr = adminAddr
+	}
+
+	if adminToken, exists := os.LookupEnv("ADMIN_TOKEN"); exists {
+		cfg.AdminToken = adminToken
+	}
+
+	// Comma separated <dependency>=<limit>, such as "db=4,order-service=2,inspector=2".
+	if bulkheadLimits, exists := os.LookupEnv("BULKHEAD_LIMITS"); exists {
+		limits, err := parseBulkheadLimits(bulkheadLimits)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid env 'BULKHEAD_LIMITS': %w", err)
+		}
+		cfg.BulkheadLimits = limits
+	}
+
+	if bulkheadQueueTimeout, exists := os.LookupEnv("BULKHEAD_QUEUE_TIMEOUT"); exists {
+		if val, err := time.ParseDuration(bulkheadQueueTimeout); err == nil {
+			cfg.BulkheadQueueTimeout = val
+		}
+	}
+
+	if circuitFallback, exists := os.LookupEnv("CIRCUIT_FALLBACK"); exists {
+		if !tasks.IsFallback(circuitFallback) {
+			return nil, fmt.Errorf("Invalid env 'CIRCUIT_FALLBACK': %s", circuitFallback)
+		}
+		cfg.CircuitFallback = circuitFallback
+	}
+
 	if workerCount, exists := os.LookupEnv("WORKER_COUNT"); exists {
 		if val, err := strconv.Atoi(workerCount); err == nil {
 			cfg.WorkerCount = val
@@ -95,13 +300,58 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("Missing env 'SERVER_QUEUE_NAME'.")
 	}
 
+	// A comma separated list fans out to every queue.
 	if nextQueueName, exists := os.LookupEnv("NEXT_QUEUE_NAME"); exists {
-		cfg.QueueConfig.Next = nextQueueName
+		cfg.QueueConfig.NextQueues = strings.Split(nextQueueName, ",")
+		cfg.QueueConfig.Next = cfg.QueueConfig.NextQueues[0]
 	}
 
 	if previousQueueName, exists := os.LookupEnv("PREVIOUS_QUEUE_NAME"); exists {
 		cfg.QueueConfig.Previous = previousQueueName
 	}
 
+	cfg.QueueConfig.DeadLetter = fmt.Sprintf("%s:dead_letter", cfg.QueueConfig.Server)
+	if deadLetterQueueName, exists := os.LookupEnv("DEAD_LETTER_QUEUE_NAME"); exists {
+		cfg.QueueConfig.DeadLetter = deadLetterQueueName
+	}
+
+	cfg.QueueConfig.Webhooks = fmt.Sprintf("%s:webhooks", cfg.QueueConfig.Server)
+	if webhookQueueName, exists := os.LookupEnv("WEBHOOK_QUEUE_NAME"); exists {
+		cfg.QueueConfig.Webhooks = webhookQueueName
+	}
+
+	if steps, exists := os.LookupEnv("ORCHESTRATOR_STEPS"); exists {
+		cfg.OrchestratorConfig.Steps = strings.Split(steps, ",")
+	}
+
+	if stepTimeout, exists := os.LookupEnv("ORCHESTRATOR_STEP_TIMEOUT"); exists {
+		if val, err := time.ParseDuration(stepTimeout); err == nil {
+			cfg.OrchestratorConfig.StepTimeout = val
+		}
+	}
+
+	if maxAttempts, exists := os.LookupEnv("ORCHESTRATOR_MAX_ATTEMPTS"); exists {
+		if val, err := strconv.Atoi(maxAttempts); err == nil {
+			cfg.OrchestratorConfig.MaxAttempts = val
+		}
+	}
+
 	return cfg, nil
 }
+
+func parseBulkheadLimits(str string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, entry := range strings.Split(str, ",") {
+		name, limit, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("Expected <dependency>=<limit>, got %q", entry)
+		}
+
+		val, err := strconv.Atoi(limit)
+		if err != nil || val < 1 {
+			return nil, fmt.Errorf("Invalid limit for %s: %s", name, limit)
+		}
+		limits[name] = val
+	}
+	return limits, nil
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/alex-appy-love-story/worker-template/tasks"
+)
+
+// DeadLetters is the operator command to inspect and replay dead-lettered
+// compensations.
+//
+//	dead-letters list
+//	dead-letters replay <task id>
+//	dead-letters replay-all
+func (a *App) DeadLetters(args []string) error {
+	queue := a.Config.QueueConfig.DeadLetter
+
+	command := "list"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "list":
+		deadLetters, err := tasks.ListDeadLetters(a.AsynqInspector, queue)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d dead letter(s) in %s\n", len(deadLetters), queue)
+		for _, d := range deadLetters {
+			fmt.Printf("%s\t%s\t%s\tretried: %d\tfailed at: %s\terror: %s\n",
+				d.ID, d.Type, d.Queue, d.Retried, d.FailedAt.Format("2006-01-02 15:04:05"), d.Error)
+		}
+		return nil
+
+	case "replay":
+		if len(args) < 2 {
+			return fmt.Errorf("Usage: dead-letters replay <task id>")
+		}
+		if err := tasks.ReplayDeadLetter(a.AsynqClient, a.AsynqInspector, queue, args[1]); err != nil {
+			return err
+		}
+		fmt.Println("Replayed", args[1])
+		return nil
+
+	case "replay-all":
+		deadLetters, err := tasks.ListDeadLetters(a.AsynqInspector, queue)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range deadLetters {
+			if err := tasks.ReplayDeadLetter(a.AsynqClient, a.AsynqInspector, queue, d.ID); err != nil {
+				return fmt.Errorf("Failed to replay %s: %w", d.ID, err)
+			}
+			fmt.Println("Replayed", d.ID)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("Unknown dead-letters command: %s", command)
+	}
+}
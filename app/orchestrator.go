@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/alex-appy-love-story/worker-template/orchestrator"
+	"github.com/alex-appy-love-story/worker-template/tasks"
+	"github.com/hibiken/asynq"
+)
+
+// StartOrchestrator runs the orchestrator on the server queue instead of a step.
+func (a *App) StartOrchestrator(ctx context.Context) error {
+	// Handle SIGINT (CTRL+C) gracefully.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Set up OpenTelemetry.
+	otelShutdown, err := SetupOTelSDK(ctx, a.Config)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	// Handle shutdown properly so nothing leaks.
+	defer func() {
+		err = errors.Join(err, otelShutdown(ctx))
+	}()
+
+	defer func() {
+		if err := a.OrderClient.Close(); err != nil {
+			fmt.Println("Failed to close order client", err)
+		}
+		if err := a.AsynqClient.Close(); err != nil {
+			fmt.Println("Failed to close redis", err)
+		}
+	}()
+
+	orch := orchestrator.New(orchestrator.Config{
+		Queue:         a.Config.QueueConfig.Server,
+		Steps:         a.Config.OrchestratorConfig.Steps,
+		StepTimeout:   a.Config.OrchestratorConfig.StepTimeout,
+		MaxAttempts:   a.Config.OrchestratorConfig.MaxAttempts,
+		OrderClient:   a.OrderClient,
+		ContentType:   a.Config.ContentType,
+		SchemaVersion: a.Config.SchemaVersion,
+		SagaTimeout:   a.Config.SagaTimeout,
+	}, a.AsynqClient, a.AsynqInspector, orchestrator.NewRedisStore(a.RedisClient, a.Config.QueueConfig.Server))
+
+	server := asynq.NewServer(
+		asynq.RedisClientOpt{Addr: a.Config.RedisAddress},
+		asynq.Config{
+			Concurrency: a.Config.WorkerCount,
+			Queues: map[string]int{
+				a.Config.QueueConfig.Server: 10,
+			},
+		},
+	)
+
+	fmt.Println("Starting orchestrator with steps:", a.Config.OrchestratorConfig.Steps)
+
+	mux := asynq.NewServeMux()
+
+	mux.Use(tasks.LoggingMiddleware)
+
+	orch.RegisterTopic(mux)
+
+	go orch.Run(ctx)
+
+	return a.serve(ctx, server, mux)
+}
@@ -6,9 +6,11 @@ import (
 	"log"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -61,6 +63,17 @@ func SetupOTelSDK(ctx context.Context, config Config) (shutdown func(context.Con
 	shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
 	otel.SetTracerProvider(tracerProvider)
 
+	// Set up meter provider.
+	// NOTE(Appy): The instruments created before, such as the breaker metrics,
+	// report to it from now on.
+	meterProvider, err := newMeterProvider(res, config.OtelConfig)
+	if err != nil {
+		handleErr(err)
+		return
+	}
+	shutdownFuncs = append(shutdownFuncs, meterProvider.Shutdown)
+	otel.SetMeterProvider(meterProvider)
+
 	return
 }
 
@@ -107,3 +120,26 @@ func newTraceProvider(res *resource.Resource, cfg OtelConfig) (*trace.TracerProv
 	), nil
 
 }
+
+func newMeterProvider(res *resource.Resource, cfg OtelConfig) (*sdkmetric.MeterProvider, error) {
+	secureOption := otlpmetricgrpc.WithTLSCredentials(credentials.NewClientTLSFromCert(nil, ""))
+	if len(cfg.Insecure) > 0 {
+		secureOption = otlpmetricgrpc.WithInsecure()
+	}
+
+	exporter, err := otlpmetricgrpc.New(
+		context.Background(),
+		secureOption,
+		otlpmetricgrpc.WithEndpoint(cfg.ExporterEndpoint),
+	)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	), nil
+}
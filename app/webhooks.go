@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	db "github.com/alex-appy-love-story/db-lib"
+	"github.com/alex-appy-love-story/worker-template/webhooks"
+)
+
+func (a *App) initWebhooks() error {
+	if err := db.InitTables(a.DBClient, &webhooks.Endpoint{}); err != nil {
+		return err
+	}
+
+	if err := db.InitTables(a.DBClient, &webhooks.Delivery{}); err != nil {
+		return err
+	}
+
+	a.Webhooks = webhooks.NewDispatcher(a.DBClient, a.AsynqClient, a.Config.QueueConfig.Webhooks)
+	return nil
+}
+
+// WebhookCommand is the operator command to manage the webhook endpoints and
+// replay deliveries.
+//
+//	webhooks register <url> <secret> [event types, comma separated]
+//	webhooks endpoints
+//	webhooks disable <endpoint id>
+//	webhooks deliveries [pending|succeeded|failed]
+//	webhooks replay <delivery id>
+func (a *App) WebhookCommand(args []string) error {
+	ctx := context.Background()
+
+	if err := a.connectDB(ctx); err != nil {
+		return err
+	}
+	if a.DBClient == nil {
+		return fmt.Errorf("Webhooks need a database, set DB_NAME")
+	}
+	if err := a.initWebhooks(); err != nil {
+		return err
+	}
+
+	command := "deliveries"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "register":
+		if len(args) < 3 {
+			return fmt.Errorf("Usage: webhooks register <url> <secret> [event types]")
+		}
+		events := ""
+		if len(args) > 3 {
+			events = args[3]
+		}
+		endpoint, err := webhooks.CreateEndpoint(a.DBClient, args[1], args[2], events)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Registered endpoint", endpoint.ID)
+		return nil
+
+	case "endpoints":
+		endpoints, err := webhooks.ListEndpoints(a.DBClient)
+		if err != nil {
+			return err
+		}
+		for _, e := range endpoints {
+			fmt.Printf("%d\t%s\tevents: %s\tactive: %t\n", e.ID, e.URL, e.Events, e.Active)
+		}
+		return nil
+
+	case "disable":
+		if len(args) < 2 {
+			return fmt.Errorf("Usage: webhooks disable <endpoint id>")
+		}
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		return webhooks.SetEndpointActive(a.DBClient, uint(id), false)
+
+	case "deliveries":
+		status := ""
+		if len(args) > 1 {
+			status = args[1]
+		}
+		deliveries, err := webhooks.ListDeliveries(a.DBClient, status, 100)
+		if err != nil {
+			return err
+		}
+		for _, d := range deliveries {
+			fmt.Printf("%d\tendpoint: %d\t%s\t%s\t%s\tattempts: %d\tcode: %d\terror: %s\n",
+				d.ID, d.EndpointID, d.EventType, d.EventID, d.Status, d.Attempts, d.LastStatusCode, d.LastError)
+		}
+		return nil
+
+	case "replay":
+		if len(args) < 2 {
+			return fmt.Errorf("Usage: webhooks replay <delivery id>")
+		}
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		if err := a.Webhooks.Replay(ctx, uint(id)); err != nil {
+			return err
+		}
+		fmt.Println("Replayed", args[1])
+		return nil
+
+	default:
+		return fmt.Errorf("Unknown webhooks command: %s", command)
+	}
+}
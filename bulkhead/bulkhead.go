@@ -0,0 +1,128 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the dependencies shared by the services.
+const (
+	DATABASE      = "db"
+	ORDER_SERVICE = "order-service"
+	INSPECTOR     = "inspector"
+)
+
+var ErrFull = errors.New("Bulkhead full")
+
+// Bulkhead limits the calls in flight to a dependency, so a slow one can't
+// hold every worker. Calls over the limit wait up to the queue timeout for a
+// slot, then fail with ErrFull. A nil Bulkhead doesn't limit anything.
+type Bulkhead struct {
+	name         string
+	slots        chan struct{}
+	queueTimeout time.Duration
+
+	waiting  int64
+	rejected int64
+}
+
+type Options struct {
+	MaxConcurrent *int
+	// QueueTimeout is how long a call waits for a slot, 0 fails at once.
+	QueueTimeout *time.Duration
+}
+
+func New(name string, opts ...Options) *Bulkhead {
+	var opt Options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	if opt.MaxConcurrent == nil || *opt.MaxConcurrent < 1 {
+		opt.MaxConcurrent = IntToPointer(4)
+	}
+
+	if opt.QueueTimeout == nil {
+		opt.QueueTimeout = TimeToPointer(time.Second)
+	}
+
+	return &Bulkhead{
+		name:         name,
+		slots:        make(chan struct{}, *opt.MaxConcurrent),
+		queueTimeout: *opt.QueueTimeout,
+	}
+}
+
+// Acquire takes a slot, release must be called once the call is over.
+func (b *Bulkhead) Acquire(ctx context.Context) (release func(), err error) {
+	if b == nil {
+		return func() {}, nil
+	}
+
+	// Fast path, a free slot.
+	select {
+	case b.slots <- struct{}{}:
+		recordAcquired(b.name, 0)
+		return b.release, nil
+	default:
+	}
+
+	atomic.AddInt64(&b.waiting, 1)
+	defer atomic.AddInt64(&b.waiting, -1)
+
+	start := time.Now()
+	timer := time.NewTimer(b.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case b.slots <- struct{}{}:
+		recordAcquired(b.name, time.Since(start))
+		return b.release, nil
+	case <-timer.C:
+		atomic.AddInt64(&b.rejected, 1)
+		recordRejected(b.name)
+		return nil, fmt.Errorf("%w: %s", ErrFull, b.name)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *Bulkhead) release() {
+	<-b.slots
+}
+
+// Do runs f in a slot.
+func (b *Bulkhead) Do(ctx context.Context, f func() error) error {
+	release, err := b.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return f()
+}
+
+// Stats is a bulkhead as shown in the health output.
+type Stats struct {
+	Name       string  `json:"name"`
+	InFlight   int     `json:"in_flight"`
+	Capacity   int     `json:"capacity"`
+	Waiting    int64   `json:"waiting"`
+	Rejected   int64   `json:"rejected"`
+	Saturation float64 `json:"saturation"` // InFlight over Capacity.
+}
+
+func (b *Bulkhead) Stats() Stats {
+	inFlight := len(b.slots)
+	return Stats{
+		Name:       b.name,
+		InFlight:   inFlight,
+		Capacity:   cap(b.slots),
+		Waiting:    atomic.LoadInt64(&b.waiting),
+		Rejected:   atomic.LoadInt64(&b.rejected),
+		Saturation: float64(inFlight) / float64(cap(b.slots)),
+	}
+}
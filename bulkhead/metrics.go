@@ -0,0 +1,91 @@
+package bulkhead
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	meter = otel.Meter("bulkhead")
+
+	waitHistogram   metric.Float64Histogram
+	rejectedCounter metric.Int64Counter
+	inFlightGauge   metric.Int64ObservableGauge
+	waitingGauge    metric.Int64ObservableGauge
+	saturationGauge metric.Float64ObservableGauge
+)
+
+func init() {
+	var err error
+
+	waitHistogram, err = meter.Float64Histogram("bulkhead.wait_time",
+		metric.WithDescription("Time spent waiting for a slot."), metric.WithUnit("s"))
+	if err != nil {
+		log.Println("Failed to create bulkhead metric:", err)
+	}
+
+	rejectedCounter, err = meter.Int64Counter("bulkhead.rejected",
+		metric.WithDescription("Calls which timed out waiting for a slot."))
+	if err != nil {
+		log.Println("Failed to create bulkhead metric:", err)
+	}
+
+	inFlightGauge, err = meter.Int64ObservableGauge("bulkhead.in_flight",
+		metric.WithDescription("Calls holding a slot."))
+	if err != nil {
+		log.Println("Failed to create bulkhead metric:", err)
+	}
+
+	waitingGauge, err = meter.Int64ObservableGauge("bulkhead.waiting",
+		metric.WithDescription("Calls waiting for a slot."))
+	if err != nil {
+		log.Println("Failed to create bulkhead metric:", err)
+	}
+
+	saturationGauge, err = meter.Float64ObservableGauge("bulkhead.saturation",
+		metric.WithDescription("Slots in use over the capacity, 0 to 1."))
+	if err != nil {
+		log.Println("Failed to create bulkhead metric:", err)
+	}
+}
+
+func recordAcquired(name string, wait time.Duration) {
+	if waitHistogram == nil {
+		return
+	}
+	waitHistogram.Record(context.Background(), wait.Seconds(),
+		metric.WithAttributes(attribute.String("bulkhead", name)))
+}
+
+func recordRejected(name string) {
+	if rejectedCounter == nil {
+		return
+	}
+	rejectedCounter.Add(context.Background(), 1,
+		metric.WithAttributes(attribute.String("bulkhead", name)))
+}
+
+// observe reports the saturation of every bulkhead of the registry to the meter.
+func (r *Registry) observe() {
+	if inFlightGauge == nil || waitingGauge == nil || saturationGauge == nil {
+		return
+	}
+
+	_, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, stats := range r.Stats() {
+			attrs := metric.WithAttributes(attribute.String("bulkhead", stats.Name))
+			o.ObserveInt64(inFlightGauge, int64(stats.InFlight), attrs)
+			o.ObserveInt64(waitingGauge, stats.Waiting, attrs)
+			o.ObserveFloat64(saturationGauge, stats.Saturation, attrs)
+		}
+		return nil
+	}, inFlightGauge, waitingGauge, saturationGauge)
+	if err != nil {
+		log.Println("Failed to observe bulkheads:", err)
+	}
+}
@@ -0,0 +1,73 @@
+package bulkhead
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry holds one bulkhead per dependency, created on first use.
+type Registry struct {
+	defaults  Options
+	options   map[string]Options
+	bulkheads map[string]*Bulkhead
+
+	mutex sync.Mutex
+}
+
+func NewRegistry(defaults Options) *Registry {
+	r := &Registry{
+		defaults:  defaults,
+		options:   make(map[string]Options),
+		bulkheads: make(map[string]*Bulkhead),
+	}
+	r.observe()
+	return r
+}
+
+// Configure sets the options of a bulkhead, before it is first used.
+func (r *Registry) Configure(name string, opt Options) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.options[name] = opt
+}
+
+// Get returns nil on a nil registry, which doesn't limit anything.
+func (r *Registry) Get(name string) *Bulkhead {
+	if r == nil {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if b, ok := r.bulkheads[name]; ok {
+		return b
+	}
+
+	opt, ok := r.options[name]
+	if !ok {
+		opt = r.defaults
+	}
+
+	b := New(name, opt)
+	r.bulkheads[name] = b
+	return b
+}
+
+// Stats of the bulkheads in use, sorted by name.
+func (r *Registry) Stats() []Stats {
+	r.mutex.Lock()
+	names := make([]string, 0, len(r.bulkheads))
+	for name := range r.bulkheads {
+		names = append(names, name)
+	}
+	r.mutex.Unlock()
+
+	sort.Strings(names)
+
+	stats := make([]Stats, 0, len(names))
+	for _, name := range names {
+		stats = append(stats, r.Get(name).Stats())
+	}
+	return stats
+}
@@ -0,0 +1,13 @@
+package bulkhead
+
+import (
+	"time"
+)
+
+func IntToPointer(x int) *int {
+	return &x
+}
+
+func TimeToPointer(x time.Duration) *time.Duration {
+	return &x
+}
@@ -2,6 +2,8 @@ package circuitbreaker
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
 	"sync"
 	"time"
 )
@@ -22,21 +24,65 @@ var (
 	}
 )
 
+// CB is safe for concurrent use. Every request asks Allow() first and, if it
+// was allowed, reports its outcome with Report().
 type CB struct {
 	maxConsecutiveFails uint64
 	openInterval        time.Duration
+	maxHalfOpenProbes   uint64
+	clock               Clock
 
-	// fails is the number of failed requets for the current "Closed" state,
-	// resets after a successful transition from half-open to closed.
+	// Sliding window mode, nil when tripping on consecutive fails.
+	window                window
+	failureRateThreshold  float64
+	slowCallRateThreshold float64
+	slowCallDuration      time.Duration
+	minimumCalls          uint64
+
+	// fails is the number of consecutive failed requests in the "Closed" state.
 	fails uint64
 
 	// current state of the circuit
 	state State
 
-	// openChannel handles the event transfer mechanism for the open state
-	openChannel chan struct{}
+	// openedAt is when the circuit last opened, it turns half-open after
+	// currentInterval, which backs off from openInterval on every open period
+	// in a row.
+	openedAt        time.Time
+	currentInterval time.Duration
+
+	// Back-off of the open interval, forgotten once closed for backoffResetAfter.
+	backoffMultiplier float64
+	maxOpenInterval   time.Duration
+	jitter            float64
+	backoffResetAfter time.Duration
+	openPeriods       uint64 // Open periods in a row.
+	closedAt          time.Time
+	rand              *rand.Rand
+
+	// probes in flight and probes which succeeded in the "Half-Open" state.
+	probes         uint64
+	probeSuccesses uint64
+
+	// Shared mode, store is nil when the breaker only counts on this replica.
+	name         string
+	store        Store
+	syncInterval time.Duration
+	syncedAt     time.Time
+	changedAt    time.Time // Last transition, compared with the shared one.
+	storeDown    bool
 
-	mutex *sync.Mutex
+	// Forced state, set by an operator.
+	override  *Override
+	overrides OverrideStore
+
+	onStateChange func(name string, t Transition)
+	// changes made while the mutex is held, handed out once it is released.
+	changes []Transition
+	// calls to the store queued while the mutex is held, run once it is released.
+	calls []func() []Transition
+
+	mutex sync.Mutex
 }
 
 type CBOptions struct {
@@ -45,6 +91,46 @@ type CBOptions struct {
 	MaxConsecutiveFails *uint64
 
 	OpenInterval *time.Duration
+
+	// OpenIntervalMultiplier grows the open interval on every open period in a
+	// row, up to MaxOpenInterval, 1 disables the back-off. OpenIntervalJitter
+	// spreads the probes of the replicas, shortening the interval by up to
+	// this fraction. The back-off is reset once closed for BackoffResetAfter.
+	// Both are off by default, 1 and 0.
+	OpenIntervalMultiplier *float64
+	MaxOpenInterval        *time.Duration
+	OpenIntervalJitter     *float64
+	BackoffResetAfter      *time.Duration
+
+	// MaxHalfOpenProbes is the number of requests let through in the "Half-Open"
+	// state. The circuit closes once all of them succeeded.
+	MaxHalfOpenProbes *uint64
+
+	Clock Clock
+
+	// WindowType switches from consecutive fails to a sliding window, which
+	// trips once FailureRateThreshold or SlowCallRateThreshold is reached over
+	// at least MinimumCalls calls.
+	WindowType     WindowType
+	WindowSize     *uint64        // WINDOW_COUNT, in calls.
+	WindowDuration *time.Duration // WINDOW_TIME, rounded down to the second.
+
+	FailureRateThreshold  *float64 // 0 to 1.
+	SlowCallRateThreshold *float64 // 0 to 1, disabled if unset.
+	SlowCallDuration      *time.Duration
+	MinimumCalls          *uint64
+
+	// Store shares the state and the consecutive fails with the other replicas,
+	// synced every SyncInterval. Name identifies the breaker in the store.
+	Name         string
+	Store        Store
+	SyncInterval *time.Duration
+
+	// Overrides shares the forced states with the other replicas.
+	Overrides OverrideStore
+
+	// OnStateChange is called on every transition, without the mutex held.
+	OnStateChange func(name string, t Transition)
 }
 
 func NewCircuitBreaker(opts ...CBOptions) *CB {
@@ -61,74 +147,347 @@ func NewCircuitBreaker(opts ...CBOptions) *CB {
 		opt.OpenInterval = TimeToPointer(8 * time.Second)
 	}
 
+	if opt.OpenIntervalMultiplier == nil || *opt.OpenIntervalMultiplier < 1 {
+		opt.OpenIntervalMultiplier = FloatToPointer(1)
+	}
+
+	if opt.MaxOpenInterval == nil {
+		opt.MaxOpenInterval = TimeToPointer(2 * time.Minute)
+	}
+
+	if *opt.MaxOpenInterval < *opt.OpenInterval {
+		opt.MaxOpenInterval = opt.OpenInterval
+	}
+
+	if opt.OpenIntervalJitter == nil || *opt.OpenIntervalJitter < 0 || *opt.OpenIntervalJitter >= 1 {
+		opt.OpenIntervalJitter = FloatToPointer(0)
+	}
+
+	if opt.BackoffResetAfter == nil {
+		opt.BackoffResetAfter = TimeToPointer(time.Minute)
+	}
+
+	if opt.MaxHalfOpenProbes == nil || *opt.MaxHalfOpenProbes == 0 {
+		opt.MaxHalfOpenProbes = IntToPointer(uint64(1))
+	}
+
+	if opt.Clock == nil {
+		opt.Clock = realClock{}
+	}
+
+	if opt.SyncInterval == nil {
+		opt.SyncInterval = TimeToPointer(DEFAULT_SYNC_INTERVAL)
+	}
+
 	cb := &CB{
 		maxConsecutiveFails: *opt.MaxConsecutiveFails,
 		openInterval:        *opt.OpenInterval,
-		openChannel:         make(chan struct{}),
-		mutex:               &sync.Mutex{},
+		maxHalfOpenProbes:   *opt.MaxHalfOpenProbes,
+		clock:               opt.Clock,
+		state:               closed,
+		name:                opt.Name,
+		store:               opt.Store,
+		syncInterval:        *opt.SyncInterval,
+		overrides:           opt.Overrides,
+		onStateChange:       opt.OnStateChange,
+		backoffMultiplier:   *opt.OpenIntervalMultiplier,
+		maxOpenInterval:     *opt.MaxOpenInterval,
+		jitter:              *opt.OpenIntervalJitter,
+		backoffResetAfter:   *opt.BackoffResetAfter,
+		rand:                rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 
-	cb.state = closed
-
-	go cb.OpenWatcher()
+	if opt.WindowType != WINDOW_NONE {
+		cb.initWindow(opt)
+	}
 
 	return cb
 }
 
-func (cb *CB) FailsExcceededThreshold() bool {
-	return cb.fails >= cb.maxConsecutiveFails
+func (cb *CB) initWindow(opt CBOptions) {
+	switch opt.WindowType {
+	case WINDOW_TIME:
+		if opt.WindowDuration == nil {
+			opt.WindowDuration = TimeToPointer(60 * time.Second)
+		}
+		cb.window = newTimeWindow(*opt.WindowDuration)
+	default:
+		if opt.WindowSize == nil || *opt.WindowSize == 0 {
+			opt.WindowSize = IntToPointer(uint64(100))
+		}
+		cb.window = newCountWindow(*opt.WindowSize)
+	}
+
+	if opt.FailureRateThreshold == nil {
+		opt.FailureRateThreshold = FloatToPointer(0.5)
+	}
+
+	// Slow calls don't trip the circuit unless asked for.
+	if opt.SlowCallRateThreshold == nil {
+		opt.SlowCallRateThreshold = FloatToPointer(0)
+	}
+
+	if opt.SlowCallDuration == nil {
+		opt.SlowCallDuration = TimeToPointer(5 * time.Second)
+	}
+
+	if opt.MinimumCalls == nil {
+		opt.MinimumCalls = IntToPointer(uint64(10))
+	}
+
+	cb.failureRateThreshold = *opt.FailureRateThreshold
+	cb.slowCallRateThreshold = *opt.SlowCallRateThreshold
+	cb.slowCallDuration = *opt.SlowCallDuration
+	cb.minimumCalls = *opt.MinimumCalls
+}
+
+// Allow reports whether a request may go through. In the "Half-Open" state it
+// reserves one of the probes, the request must be reported.
+func (cb *CB) Allow() bool {
+	allowed, _ := cb.allow()
+	return allowed
 }
 
-func (cb *CB) OpenWatcher() {
-	for range cb.openChannel {
-		time.Sleep(cb.openInterval)
-		cb.mutex.Lock()
-		cb.state = halfOpen
-		cb.fails = 0
-		cb.mutex.Unlock()
+func (cb *CB) allow() (allowed bool, changes []Transition) {
+	changes = cb.refresh()
+
+	cb.mutex.Lock()
+	defer func() {
+		changes = append(changes, cb.unlock()...)
+		if !allowed {
+			recordCall(cb.name, "rejected")
+		}
+	}()
+
+	switch cb.currentState() {
+	case closed:
+		return true, nil
+	case halfOpen:
+		if cb.probes+cb.probeSuccesses >= cb.maxHalfOpenProbes {
+			return false, nil
+		}
+		cb.probes++
+		return true, nil
+	default:
+		return false, nil
 	}
 }
 
-// Getters
-func (cb *CB) Fails() uint64 {
-	return cb.fails
+// Report records the outcome of a request.
+func (cb *CB) Report(success bool) {
+	cb.ReportCall(success, 0)
 }
-func (cb *CB) MaxFails() uint64 {
-	return cb.maxConsecutiveFails
+
+// ReportCall records the outcome of a request and how long it took, for the
+// slow-call rate of the sliding window.
+func (cb *CB) ReportCall(success bool, duration time.Duration) {
+	cb.report(success, duration)
 }
-func (cb *CB) State() State {
+
+// Release gives back the probe reserved by Allow for a request which never
+// reached the dependency, nothing is learned from it.
+func (cb *CB) Release() {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	if cb.state == halfOpen && cb.probes > 0 {
+		cb.probes--
+	}
+}
+
+func (cb *CB) report(success bool, duration time.Duration) (changes []Transition) {
+	changes = cb.refresh()
+
+	cb.mutex.Lock()
+	defer func() {
+		changes = append(changes, cb.unlock()...)
+		if success {
+			recordCall(cb.name, "success")
+		} else {
+			recordCall(cb.name, "failure")
+		}
+	}()
+
+	state := cb.currentState()
+	if cb.activeOverride() != nil {
+		return nil
+	}
+
+	switch state {
+	case closed:
+		if cb.window != nil {
+			cb.recordWindow(success, duration)
+			return nil
+		}
+		if success {
+			cb.resetFails()
+			return nil
+		}
+		cb.addFail()
+
+	case halfOpen:
+		if cb.probes > 0 {
+			cb.probes--
+		}
+		if !success {
+			cb.trip()
+			return nil
+		}
+		cb.probeSuccesses++
+		if cb.probeSuccesses >= cb.maxHalfOpenProbes {
+			cb.reset()
+		}
+
+	default:
+		// Requests allowed before the circuit opened, nothing to learn.
+	}
+	return nil
+}
+
+// recordWindow trips the circuit once a rate is over its threshold. Must be
+// called with the mutex held.
+func (cb *CB) recordWindow(success bool, duration time.Duration) {
+	now := cb.clock.Now()
+	cb.window.record(outcome{failed: !success, slow: duration >= cb.slowCallDuration}, now)
+
+	counts := cb.window.counts(now)
+	if counts.calls < cb.minimumCalls {
+		return
+	}
+
+	failureRate := float64(counts.fails) / float64(counts.calls)
+	slowCallRate := float64(counts.slow) / float64(counts.calls)
+
+	slowCallsTrip := cb.slowCallRateThreshold > 0 && slowCallRate >= cb.slowCallRateThreshold
+	if failureRate >= cb.failureRateThreshold || slowCallsTrip {
+		cb.trip()
+	}
+}
+
+// currentState moves an open circuit to half-open once the open interval is
+// over. A forced state wins over it. Must be called with the mutex held, after
+// refresh().
+func (cb *CB) currentState() State {
+	if o := cb.activeOverride(); o != nil {
+		return o.State
+	}
+	if cb.state == open && !cb.clock.Now().Before(cb.openedAt.Add(cb.currentInterval)) {
+		cb.setState(halfOpen, cb.clock.Now())
+		cb.probes = 0
+		cb.probeSuccesses = 0
+	}
 	return cb.state
 }
-func (cb *CB) Mutex() *sync.Mutex {
-	return cb.mutex
+
+func (cb *CB) trip() {
+	cb.open(cb.clock.Now())
+	cb.publish()
 }
-func (cb *CB) OpenChannel() chan struct{} {
-	return cb.openChannel
+
+func (cb *CB) reset() {
+	cb.close(cb.clock.Now())
+	cb.publish()
 }
 
-// Setters
-func (cb *CB) SetFails(num uint64) uint64 {
-	cb.fails = num
-	return cb.fails
+func (cb *CB) open(at time.Time) {
+	// A circuit which stayed closed long enough starts over from openInterval.
+	if cb.state == closed && !cb.closedAt.IsZero() && at.Sub(cb.closedAt) >= cb.backoffResetAfter {
+		cb.openPeriods = 0
+	}
+
+	cb.setState(open, at)
+	cb.openedAt = at
+	cb.currentInterval = cb.nextInterval()
+	cb.openPeriods++
+	cb.changedAt = at
+	cb.fails = 0
+	if cb.window != nil {
+		cb.window.reset()
+	}
 }
-func (cb *CB) SetState(stateStr string) State {
-	tmpState, ok := StringToState(stateStr)
-	if ok != true {
-		fmt.Println("State doesn't exist: ", stateStr)
+
+func (cb *CB) close(at time.Time) {
+	cb.setState(closed, at)
+	cb.closedAt = at
+	cb.changedAt = at
+	cb.fails = 0
+	if cb.window != nil {
+		cb.window.reset()
 	}
-	cb.state = tmpState
-	return cb.state
+	cb.probes = 0
+	cb.probeSuccesses = 0
+}
+
+// nextInterval backs off exponentially from openInterval, with jitter. Must be
+// called with the mutex held.
+func (cb *CB) nextInterval() time.Duration {
+	interval := float64(cb.openInterval) * math.Pow(cb.backoffMultiplier, float64(cb.openPeriods))
+	interval = math.Min(interval, float64(cb.maxOpenInterval))
+
+	// Only ever shorter, the cap holds.
+	if cb.jitter > 0 {
+		interval -= interval * cb.jitter * cb.rand.Float64()
+	}
+
+	return time.Duration(interval)
+}
+
+// setState records the transition for unlock(). Must be called with the mutex
+// held.
+func (cb *CB) setState(state State, at time.Time) {
+	if cb.state != state {
+		cb.changes = append(cb.changes, Transition{From: cb.state, To: state, At: at})
+	}
+	cb.state = state
 }
 
-func (cb *CB) IncrementFails() uint64 {
-	cb.fails++
+// Getters
+func (cb *CB) Name() string {
+	return cb.name
+}
+func (cb *CB) Fails() uint64 {
+	cb.mutex.Lock()
+	defer cb.unlock()
 	return cb.fails
 }
+func (cb *CB) MaxFails() uint64 {
+	return cb.maxConsecutiveFails
+}
+
+// RetryIn is how long until an open circuit lets probes through, 0 if it isn't open.
+func (cb *CB) RetryIn() time.Duration {
+	cb.refresh()
+
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	if cb.currentState() != open {
+		return 0
+	}
+	if o := cb.activeOverride(); o != nil {
+		return o.Until.Sub(cb.clock.Now())
+	}
+	return cb.openedAt.Add(cb.currentInterval).Sub(cb.clock.Now())
+}
+
+// OpenInterval is how long the circuit stays open this time, after the back-off.
+func (cb *CB) OpenInterval() time.Duration {
+	cb.mutex.Lock()
+	defer cb.unlock()
+	return cb.currentInterval
+}
+func (cb *CB) State() State {
+	cb.refresh()
+
+	cb.mutex.Lock()
+	defer cb.unlock()
+	return cb.currentState()
+}
 
 func (cb *CB) IsState(stateStr string) bool {
 	tmpState, ok := StringToState(stateStr)
 	if ok != true {
 		fmt.Println("State doesn't exist: ", stateStr)
 	}
-	return cb.state == tmpState
+	return cb.State() == tmpState
 }
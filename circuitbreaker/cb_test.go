@@ -0,0 +1,620 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestBreaker trips after 3 fails and stays open 10s, without back-off nor
+// jitter unless the options say otherwise.
+func newTestBreaker(clock *FakeClock, opt CBOptions) *CB {
+	opt.Clock = clock
+	if opt.MaxConsecutiveFails == nil {
+		opt.MaxConsecutiveFails = IntToPointer(3)
+	}
+	if opt.OpenInterval == nil {
+		opt.OpenInterval = TimeToPointer(10 * time.Second)
+	}
+	if opt.OpenIntervalMultiplier == nil {
+		opt.OpenIntervalMultiplier = FloatToPointer(1)
+	}
+	if opt.OpenIntervalJitter == nil {
+		opt.OpenIntervalJitter = FloatToPointer(0)
+	}
+	return NewCircuitBreaker(opt)
+}
+
+func fail(t *testing.T, cb *CB, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if !cb.Allow() {
+			t.Fatalf("request %d rejected in state %s", i, cb.State())
+		}
+		cb.Report(false)
+	}
+}
+
+func assertState(t *testing.T, cb *CB, want State) {
+	t.Helper()
+	if got := cb.State(); got != want {
+		t.Fatalf("state %s, want %s", got, want)
+	}
+}
+
+func TestClosedOpenHalfOpen(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{})
+
+	// A success in between starts the count over.
+	fail(t, cb, 2)
+	cb.Allow()
+	cb.Report(true)
+	fail(t, cb, 2)
+	assertState(t, cb, closed)
+
+	fail(t, cb, 1)
+	assertState(t, cb, open)
+	if cb.Allow() {
+		t.Error("open circuit let a request through")
+	}
+	if got := cb.RetryIn(); got != 10*time.Second {
+		t.Errorf("retry in %s, want 10s", got)
+	}
+
+	clock.Advance(10*time.Second - time.Millisecond)
+	assertState(t, cb, open)
+
+	clock.Advance(time.Millisecond)
+	assertState(t, cb, halfOpen)
+
+	if !cb.Allow() {
+		t.Fatal("half-open circuit rejected the probe")
+	}
+	cb.Report(true)
+	assertState(t, cb, closed)
+	if cb.Fails() != 0 {
+		t.Errorf("closed with %d fails", cb.Fails())
+	}
+}
+
+func TestFailedProbeReopens(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{})
+
+	fail(t, cb, 3)
+	clock.Advance(10 * time.Second)
+	assertState(t, cb, halfOpen)
+
+	fail(t, cb, 1)
+	assertState(t, cb, open)
+	if got := cb.RetryIn(); got != 10*time.Second {
+		t.Errorf("retry in %s, want 10s", got)
+	}
+}
+
+func TestProbeLimit(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{MaxHalfOpenProbes: IntToPointer(2)})
+
+	fail(t, cb, 3)
+	clock.Advance(10 * time.Second)
+
+	if !cb.Allow() || !cb.Allow() {
+		t.Fatal("half-open circuit rejected a probe")
+	}
+	if cb.Allow() {
+		t.Fatal("half-open circuit let a third probe through")
+	}
+
+	// A succeeded probe still counts, the circuit closes once both did.
+	cb.Report(true)
+	assertState(t, cb, halfOpen)
+	if cb.Allow() {
+		t.Fatal("half-open circuit let a probe through after a success")
+	}
+
+	cb.Report(true)
+	assertState(t, cb, closed)
+}
+
+func TestReleaseProbe(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{})
+
+	fail(t, cb, 3)
+	clock.Advance(10 * time.Second)
+
+	if !cb.Allow() {
+		t.Fatal("half-open circuit rejected the probe")
+	}
+	cb.Release()
+	assertState(t, cb, halfOpen)
+
+	if !cb.Allow() {
+		t.Fatal("released probe not given back")
+	}
+	cb.Report(true)
+	assertState(t, cb, closed)
+}
+
+// Requests allowed before the circuit opened don't count.
+func TestLateReportsIgnored(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{})
+
+	for i := 0; i < 4; i++ {
+		cb.Allow()
+	}
+	for i := 0; i < 3; i++ {
+		cb.Report(false)
+	}
+	assertState(t, cb, open)
+
+	cb.Report(true)
+	assertState(t, cb, open)
+}
+
+func TestOpenIntervalBackoff(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{
+		OpenIntervalMultiplier: FloatToPointer(2),
+		MaxOpenInterval:        TimeToPointer(30 * time.Second),
+		BackoffResetAfter:      TimeToPointer(time.Minute),
+	})
+
+	fail(t, cb, 3)
+	for _, want := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		if got := cb.OpenInterval(); got != want {
+			t.Fatalf("open interval %s, want %s", got, want)
+		}
+		clock.Advance(want)
+		fail(t, cb, 1)
+	}
+
+	// Closed for long enough, the back-off starts over.
+	clock.Advance(30 * time.Second)
+	cb.Allow()
+	cb.Report(true)
+	clock.Advance(time.Minute)
+	fail(t, cb, 3)
+	if got := cb.OpenInterval(); got != 10*time.Second {
+		t.Errorf("open interval %s, want 10s", got)
+	}
+}
+
+func TestOpenIntervalJitter(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{OpenIntervalJitter: FloatToPointer(0.5)})
+
+	for i := 0; i < 20; i++ {
+		fail(t, cb, 3)
+		if got := cb.OpenInterval(); got < 5*time.Second || got > 10*time.Second {
+			t.Fatalf("open interval %s, want between 5s and 10s", got)
+		}
+		clock.Advance(10 * time.Second)
+		cb.Allow()
+		cb.Report(true)
+	}
+}
+
+func TestCountWindow(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{
+		WindowType:           WINDOW_COUNT,
+		WindowSize:           IntToPointer(10),
+		MinimumCalls:         IntToPointer(4),
+		FailureRateThreshold: FloatToPointer(0.5),
+	})
+
+	// Not enough calls yet.
+	fail(t, cb, 3)
+	assertState(t, cb, closed)
+
+	// 3 fails out of 4.
+	cb.Allow()
+	cb.Report(true)
+	assertState(t, cb, open)
+
+	clock.Advance(10 * time.Second)
+	cb.Allow()
+	cb.Report(true)
+	assertState(t, cb, closed)
+
+	// 2 fails out of 5, then 3 out of 6.
+	for i := 0; i < 3; i++ {
+		cb.Allow()
+		cb.Report(true)
+	}
+	fail(t, cb, 2)
+	assertState(t, cb, closed)
+	fail(t, cb, 1)
+	assertState(t, cb, open)
+}
+
+func TestTimeWindow(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{
+		WindowType:            WINDOW_TIME,
+		WindowDuration:        TimeToPointer(10 * time.Second),
+		MinimumCalls:          IntToPointer(4),
+		FailureRateThreshold:  FloatToPointer(0.5),
+		SlowCallRateThreshold: FloatToPointer(0.5),
+		SlowCallDuration:      TimeToPointer(time.Second),
+	})
+
+	fail(t, cb, 3)
+	assertState(t, cb, closed)
+
+	// The fails are out of the window, 1 fail out of 4.
+	clock.Advance(10 * time.Second)
+	cb.Allow()
+	cb.Report(true)
+	fail(t, cb, 1)
+	for i := 0; i < 2; i++ {
+		cb.Allow()
+		cb.Report(true)
+	}
+	assertState(t, cb, closed)
+
+	// 3 slow calls out of 7, then 4 out of 8.
+	clock.Advance(5 * time.Second)
+	for i := 0; i < 3; i++ {
+		cb.Allow()
+		cb.ReportCall(true, 2*time.Second)
+	}
+	assertState(t, cb, closed)
+	cb.Allow()
+	cb.ReportCall(true, 2*time.Second)
+	assertState(t, cb, open)
+}
+
+func TestOnStateChange(t *testing.T) {
+	clock := NewFakeClock(epoch)
+
+	var transitions []Transition
+	cb := newTestBreaker(clock, CBOptions{
+		Name: "test",
+		OnStateChange: func(name string, tr Transition) {
+			if name != "test" {
+				t.Errorf("transition of %q", name)
+			}
+			transitions = append(transitions, tr)
+		},
+	})
+
+	fail(t, cb, 3)
+	clock.Advance(10 * time.Second)
+	cb.Allow()
+	cb.Report(true)
+
+	want := []Transition{
+		{From: closed, To: open, At: epoch},
+		{From: open, To: halfOpen, At: epoch.Add(10 * time.Second)},
+		{From: halfOpen, To: closed, At: epoch.Add(10 * time.Second)},
+	}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("transition %d: %v, want %v", i, transitions[i], want[i])
+		}
+	}
+}
+
+func TestForce(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{})
+
+	cb.Force(&Override{State: open, Until: epoch.Add(time.Minute)})
+	if cb.Allow() {
+		t.Error("forced open circuit let a request through")
+	}
+
+	// Forced closed, the fails aren't counted.
+	cb.Force(&Override{State: closed, Until: epoch.Add(time.Minute)})
+	fail(t, cb, 5)
+	assertState(t, cb, closed)
+
+	clock.Advance(time.Minute)
+	if cb.Override() != nil {
+		t.Error("override outlived its expiry")
+	}
+	assertState(t, cb, closed)
+}
+
+func TestConcurrentProbes(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{MaxHalfOpenProbes: IntToPointer(5)})
+
+	fail(t, cb, 3)
+	clock.Advance(10 * time.Second)
+
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cb.Allow() {
+				atomic.AddInt64(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 5 {
+		t.Fatalf("let %d probes through, want 5", allowed)
+	}
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cb.Report(true)
+		}()
+	}
+	wg.Wait()
+	assertState(t, cb, closed)
+}
+
+func TestConcurrentAllowReport(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	cb := newTestBreaker(clock, CBOptions{MaxHalfOpenProbes: IntToPointer(3)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The clock keeps moving the circuit from open to half-open.
+	go func() {
+		for ctx.Err() == nil {
+			clock.Advance(time.Second)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if cb.Allow() {
+					cb.Report((i+j)%3 != 0)
+				}
+				cb.State()
+				cb.Fails()
+			}
+		}(i)
+	}
+	wg.Wait()
+	cancel()
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	if cb.probes+cb.probeSuccesses > cb.maxHalfOpenProbes {
+		t.Errorf("%d probes in flight and %d succeeded, over the limit of %d", cb.probes, cb.probeSuccesses, cb.maxHalfOpenProbes)
+	}
+}
+
+// memStore shares the state between the breakers of a test. Every call waits
+// on block, if set.
+type memStore struct {
+	mutex     sync.Mutex
+	states    map[string]SharedState
+	overrides map[string]Override
+	block     chan struct{}
+}
+
+func newMemStore() *memStore {
+	return &memStore{states: make(map[string]SharedState), overrides: make(map[string]Override)}
+}
+
+func (s *memStore) wait(ctx context.Context) error {
+	if s.block == nil {
+		return nil
+	}
+	select {
+	case <-s.block:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *memStore) Load(ctx context.Context, name string) (SharedState, error) {
+	if err := s.wait(ctx); err != nil {
+		return SharedState{}, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.states[name], nil
+}
+
+func (s *memStore) SetState(ctx context.Context, name string, state State, changedAt time.Time) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if changedAt.After(s.states[name].ChangedAt) {
+		s.states[name] = SharedState{State: state, ChangedAt: changedAt}
+	}
+	return nil
+}
+
+func (s *memStore) AddFail(ctx context.Context, name string) (uint64, error) {
+	if err := s.wait(ctx); err != nil {
+		return 0, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	shared := s.states[name]
+	shared.Fails++
+	s.states[name] = shared
+	return shared.Fails, nil
+}
+
+func (s *memStore) ResetFails(ctx context.Context, name string) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	shared := s.states[name]
+	shared.Fails = 0
+	s.states[name] = shared
+	return nil
+}
+
+func (s *memStore) LoadOverride(ctx context.Context, name string) (*Override, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if o, ok := s.overrides[name]; ok {
+		return &o, nil
+	}
+	return nil, nil
+}
+
+func (s *memStore) ListOverrides(ctx context.Context) (map[string]Override, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	overrides := make(map[string]Override, len(s.overrides))
+	for name, o := range s.overrides {
+		overrides[name] = o
+	}
+	return overrides, nil
+}
+
+func (s *memStore) SetOverride(ctx context.Context, name string, o Override) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.overrides[name] = o
+	return nil
+}
+
+func (s *memStore) ClearOverride(ctx context.Context, name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.overrides, name)
+	return nil
+}
+
+func TestSharedState(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	store := newMemStore()
+	opt := CBOptions{Name: "db", Store: store, Overrides: store, SyncInterval: TimeToPointer(time.Second)}
+	a := newTestBreaker(clock, opt)
+	b := newTestBreaker(clock, opt)
+
+	// The fails of both replicas count.
+	fail(t, a, 2)
+	assertState(t, b, closed)
+	fail(t, b, 1)
+	assertState(t, b, open)
+
+	clock.Advance(time.Second)
+	assertState(t, a, open)
+
+	// An override reaches every replica on their next sync.
+	store.SetOverride(context.Background(), "db", Override{State: closed, Until: epoch.Add(time.Hour)})
+	clock.Advance(time.Second)
+	assertState(t, a, closed)
+	assertState(t, b, closed)
+}
+
+// A slow store doesn't hold up the requests of other goroutines.
+func TestStoreCalledWithoutMutex(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	store := newMemStore()
+	cb := newTestBreaker(clock, CBOptions{Name: "db", Store: store, Overrides: store})
+
+	// The first sync.
+	cb.State()
+
+	store.block = make(chan struct{})
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		cb.Allow()
+		cb.Report(false)
+	}()
+
+	done := make(chan State)
+	go func() { done <- cb.State() }()
+
+	select {
+	case state := <-done:
+		if state != closed {
+			t.Errorf("state %s, want closed", state)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("State() waited on the store")
+	}
+
+	close(store.block)
+	<-reported
+
+	store.mutex.Lock()
+	fails := store.states["db"].Fails
+	store.mutex.Unlock()
+	if fails != 1 {
+		t.Errorf("store counted %d fails, want 1", fails)
+	}
+
+	// Only one goroutine syncs, the others go on with the local state.
+	store.block = make(chan struct{})
+	clock.Advance(time.Second)
+	synced := make(chan struct{})
+	go func() {
+		defer close(synced)
+		cb.State()
+	}()
+
+	go func() {
+		// Let the first goroutine start the sync.
+		time.Sleep(10 * time.Millisecond)
+		done <- cb.State()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("State() waited on the sync of another goroutine")
+	}
+
+	close(store.block)
+	<-synced
+}
+
+func TestForceUnknownBreaker(t *testing.T) {
+	r := NewRegistry(CBOptions{})
+	r.Declare(DATABASE)
+	o := Override{State: open, Until: time.Now().Add(time.Minute)}
+
+	if err := r.Force(context.Background(), "DATABSE", o); !errors.Is(err, ErrUnknownBreaker) {
+		t.Errorf("forced an unknown breaker: %v", err)
+	}
+	if err := r.Clear(context.Background(), "DATABSE"); !errors.Is(err, ErrUnknownBreaker) {
+		t.Errorf("cleared an unknown breaker: %v", err)
+	}
+	if names := r.Names(); len(names) != 0 {
+		t.Errorf("created %v", names)
+	}
+
+	if err := r.Force(context.Background(), DATABASE, o); err != nil {
+		t.Fatal(err)
+	}
+	if r.Get(DATABASE).Allow() {
+		t.Error("forced open circuit let a request through")
+	}
+}
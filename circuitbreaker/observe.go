@@ -0,0 +1,171 @@
+package circuitbreaker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//----------------------------------------------
+// Transitions, metrics and span events.
+//---------------------------------------------
+
+// Transition is a change of state of a breaker.
+type Transition struct {
+	From State
+	To   State
+	At   time.Time
+}
+
+var (
+	meter = otel.Meter("circuitbreaker")
+
+	transitionCounter metric.Int64Counter
+	callCounter       metric.Int64Counter
+	stateGauge        metric.Int64ObservableGauge
+	failsGauge        metric.Int64ObservableGauge
+)
+
+func init() {
+	var err error
+
+	transitionCounter, err = meter.Int64Counter("circuitbreaker.transitions",
+		metric.WithDescription("State changes of the circuit breakers."))
+	if err != nil {
+		log.Println("Failed to create circuit breaker metric:", err)
+	}
+
+	callCounter, err = meter.Int64Counter("circuitbreaker.calls",
+		metric.WithDescription("Requests seen by the circuit breakers, by outcome: success, failure or rejected."))
+	if err != nil {
+		log.Println("Failed to create circuit breaker metric:", err)
+	}
+
+	stateGauge, err = meter.Int64ObservableGauge("circuitbreaker.state",
+		metric.WithDescription("State of the circuit breakers: 0 closed, 1 half-open, 2 open."))
+	if err != nil {
+		log.Println("Failed to create circuit breaker metric:", err)
+	}
+
+	failsGauge, err = meter.Int64ObservableGauge("circuitbreaker.consecutive_fails",
+		metric.WithDescription("Consecutive fails of the circuit breakers in the closed state."))
+	if err != nil {
+		log.Println("Failed to create circuit breaker metric:", err)
+	}
+}
+
+func stateValue(state State) int64 {
+	switch state {
+	case halfOpen:
+		return 1
+	case open:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func recordCall(name string, outcome string) {
+	if callCounter == nil {
+		return
+	}
+	callCounter.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("breaker", name),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// unlock releases the mutex, then records the transitions made while it was
+// held and hands them to the callback, and runs the queued calls to the store.
+// Every transition is returned for the span events.
+func (cb *CB) unlock() []Transition {
+	changes, calls := cb.changes, cb.calls
+	cb.changes, cb.calls = nil, nil
+	cb.mutex.Unlock()
+
+	for _, t := range changes {
+		if transitionCounter != nil {
+			transitionCounter.Add(context.Background(), 1, metric.WithAttributes(
+				attribute.String("breaker", cb.name),
+				attribute.String("from", string(t.From)),
+				attribute.String("to", string(t.To)),
+			))
+		}
+
+		if cb.onStateChange != nil {
+			cb.onStateChange(cb.name, t)
+		}
+	}
+
+	for _, call := range calls {
+		changes = append(changes, call()...)
+	}
+	return changes
+}
+
+// observe reports the state of every breaker of the registry to the meter.
+func (r *Registry) observe() {
+	if stateGauge == nil || failsGauge == nil {
+		return
+	}
+
+	_, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, name := range r.Names() {
+			cb := r.Get(name)
+			attrs := metric.WithAttributes(attribute.String("breaker", name))
+			o.ObserveInt64(stateGauge, stateValue(cb.State()), attrs)
+			o.ObserveInt64(failsGauge, int64(cb.Fails()), attrs)
+		}
+		return nil
+	}, stateGauge, failsGauge)
+	if err != nil {
+		log.Println("Failed to observe circuit breakers:", err)
+	}
+}
+
+// AllowTransitions is Allow, also returning the transitions it made.
+func (cb *CB) AllowTransitions() (bool, []Transition) {
+	return cb.allow()
+}
+
+// AllowContext is Allow, adding the transitions and a rejection to the span of
+// the context.
+func (cb *CB) AllowContext(ctx context.Context) bool {
+	allowed, changes := cb.allow()
+
+	span := trace.SpanFromContext(ctx)
+	AddTransitionEvents(span, cb.name, changes)
+	if !allowed {
+		AddRejectedEvent(span, cb)
+	}
+
+	return allowed
+}
+
+// ReportContext is ReportCall, adding the transitions to the span of the context.
+func (cb *CB) ReportContext(ctx context.Context, success bool, duration time.Duration) {
+	changes := cb.report(success, duration)
+	AddTransitionEvents(trace.SpanFromContext(ctx), cb.name, changes)
+}
+
+func AddTransitionEvents(span trace.Span, name string, changes []Transition) {
+	for _, t := range changes {
+		span.AddEvent("Circuit breaker state changed", trace.WithTimestamp(t.At), trace.WithAttributes(
+			attribute.String("breaker", name),
+			attribute.String("from", string(t.From)),
+			attribute.String("to", string(t.To)),
+		))
+	}
+}
+
+func AddRejectedEvent(span trace.Span, cb *CB) {
+	span.AddEvent("Circuit breaker rejected request", trace.WithAttributes(
+		attribute.String("breaker", cb.name),
+		attribute.String("state", string(cb.State())),
+	))
+}
@@ -0,0 +1,139 @@
+package circuitbreaker
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+//----------------------------------------------
+// Forced state.
+//---------------------------------------------
+
+// Override forces a breaker open or closed until it expires, for a planned
+// maintenance of the dependency or after a fix. The breaker doesn't count the
+// requests meanwhile.
+type Override struct {
+	State  State     `json:"state"`
+	Reason string    `json:"reason"`
+	SetAt  time.Time `json:"set_at"`
+	Until  time.Time `json:"until"`
+}
+
+// OverrideStore shares the overrides with every replica. Expired overrides
+// are never returned.
+type OverrideStore interface {
+	LoadOverride(ctx context.Context, name string) (*Override, error)
+	ListOverrides(ctx context.Context) (map[string]Override, error)
+	SetOverride(ctx context.Context, name string, o Override) error
+	ClearOverride(ctx context.Context, name string) error
+}
+
+func NewOverride(state State, reason string, ttl time.Duration) (Override, error) {
+	if state != open && state != closed {
+		return Override{}, fmt.Errorf("Only open or closed can be forced, not %s", state)
+	}
+
+	if ttl <= 0 {
+		return Override{}, fmt.Errorf("An override must expire")
+	}
+
+	now := time.Now()
+	return Override{State: state, Reason: reason, SetAt: now, Until: now.Add(ttl)}, nil
+}
+
+// activeOverride returns the forced state, dropped once it expired. Must be
+// called with the mutex held.
+func (cb *CB) activeOverride() *Override {
+	if cb.override != nil && !cb.clock.Now().Before(cb.override.Until) {
+		cb.applyOverride(nil)
+	}
+	return cb.override
+}
+
+// applyOverride records the change of the state seen by the requests. Must be
+// called with the mutex held.
+func (cb *CB) applyOverride(o *Override) {
+	from := cb.state
+	if cb.override != nil {
+		from = cb.override.State
+	}
+
+	to := cb.state
+	if o != nil {
+		to = o.State
+	}
+
+	cb.override = o
+	if from != to {
+		cb.changes = append(cb.changes, Transition{From: from, To: to, At: cb.clock.Now()})
+	}
+}
+
+// Override is the forced state of the breaker, nil if it isn't forced.
+func (cb *CB) Override() *Override {
+	cb.refresh()
+
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	if o := cb.activeOverride(); o != nil {
+		copy := *o
+		return &copy
+	}
+	return nil
+}
+
+// Force applies the override on this replica, until the next sync.
+func (cb *CB) Force(o *Override) {
+	cb.mutex.Lock()
+	defer cb.unlock()
+	cb.applyOverride(o)
+}
+
+// Force shares the override with every replica and applies it here.
+func (r *Registry) Force(ctx context.Context, name string, o Override) error {
+	if err := r.known(name); err != nil {
+		return err
+	}
+
+	if overrides := r.defaults.Overrides; overrides != nil {
+		if err := overrides.SetOverride(ctx, name, o); err != nil {
+			return err
+		}
+	}
+
+	r.Get(name).Force(&o)
+	return nil
+}
+
+// Clear lifts the override of the breaker on every replica.
+func (r *Registry) Clear(ctx context.Context, name string) error {
+	if err := r.known(name); err != nil {
+		return err
+	}
+
+	if overrides := r.defaults.Overrides; overrides != nil {
+		if err := overrides.ClearOverride(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	r.Get(name).Force(nil)
+	return nil
+}
+
+// Overrides lists the overrides of every replica, or of this one without a store.
+func (r *Registry) Overrides(ctx context.Context) (map[string]Override, error) {
+	if overrides := r.defaults.Overrides; overrides != nil {
+		return overrides.ListOverrides(ctx)
+	}
+
+	forced := make(map[string]Override)
+	for _, name := range r.Names() {
+		if o := r.Get(name).Override(); o != nil {
+			forced[name] = *o
+		}
+	}
+	return forced, nil
+}
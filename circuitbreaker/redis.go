@@ -0,0 +1,142 @@
+package circuitbreaker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	STORE_KEY_PREFIX = "circuitbreaker"
+
+	// STORE_KEY_TTL forgets breakers which are no longer used.
+	STORE_KEY_TTL = 24 * time.Hour
+)
+
+// NOTE(Appy): Replicas publish their transitions concurrently, a stale one
+// must not overwrite a newer one.
+var setStateScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], 'changed_at') or '0')
+if tonumber(ARGV[2]) <= current then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'state', ARGV[1], 'changed_at', ARGV[2], 'fails', 0)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// RedisStore keeps the shared state of each breaker in a hash, and its
+// override in a json string which expires with it:
+//
+//	circuitbreaker:<name>        state, changed_at (unix ms), fails
+//	circuitbreaker:<name>:forced Override
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) key(name string) string {
+	return STORE_KEY_PREFIX + ":" + name
+}
+
+func (s *RedisStore) Load(ctx context.Context, name string) (SharedState, error) {
+	fields, err := s.client.HGetAll(ctx, s.key(name)).Result()
+	if err != nil {
+		return SharedState{}, err
+	}
+
+	shared := SharedState{State: closed}
+	if state, ok := StringToState(fields["state"]); ok {
+		shared.State = state
+	}
+
+	if changedAt, err := strconv.ParseInt(fields["changed_at"], 10, 64); err == nil {
+		shared.ChangedAt = time.UnixMilli(changedAt)
+	}
+
+	if fails, err := strconv.ParseUint(fields["fails"], 10, 64); err == nil {
+		shared.Fails = fails
+	}
+
+	return shared, nil
+}
+
+func (s *RedisStore) SetState(ctx context.Context, name string, state State, changedAt time.Time) error {
+	return setStateScript.Run(ctx, s.client, []string{s.key(name)},
+		string(state), changedAt.UnixMilli(), STORE_KEY_TTL.Milliseconds()).Err()
+}
+
+func (s *RedisStore) AddFail(ctx context.Context, name string) (uint64, error) {
+	var fails *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		fails = pipe.HIncrBy(ctx, s.key(name), "fails", 1)
+		pipe.Expire(ctx, s.key(name), STORE_KEY_TTL)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(fails.Val()), nil
+}
+
+func (s *RedisStore) ResetFails(ctx context.Context, name string) error {
+	return s.client.HSet(ctx, s.key(name), "fails", 0).Err()
+}
+
+func (s *RedisStore) overrideKey(name string) string {
+	return s.key(name) + ":forced"
+}
+
+func (s *RedisStore) LoadOverride(ctx context.Context, name string) (*Override, error) {
+	data, err := s.client.Get(ctx, s.overrideKey(name)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var o Override
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (s *RedisStore) ListOverrides(ctx context.Context) (map[string]Override, error) {
+	forced := make(map[string]Override)
+
+	iter := s.client.Scan(ctx, 0, s.overrideKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		name := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), STORE_KEY_PREFIX+":"), ":forced")
+		o, err := s.LoadOverride(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if o != nil {
+			forced[name] = *o
+		}
+	}
+
+	return forced, iter.Err()
+}
+
+func (s *RedisStore) SetOverride(ctx context.Context, name string, o Override) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.overrideKey(name), data, time.Until(o.Until)).Err()
+}
+
+func (s *RedisStore) ClearOverride(ctx context.Context, name string) error {
+	return s.client.Del(ctx, s.overrideKey(name)).Err()
+}
@@ -0,0 +1,148 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Names of the breakers shared by the services.
+const (
+	DATABASE      = "db"
+	ORDER_SERVICE = "order-service"
+)
+
+// QueueBreaker is the name of the breaker of a downstream queue.
+func QueueBreaker(queue string) string {
+	return "queue:" + queue
+}
+
+var ErrUnknownBreaker = errors.New("Unknown circuit breaker")
+
+// Registry holds one breaker per dependency, created on first use.
+type Registry struct {
+	defaults CBOptions
+	options  map[string]CBOptions
+	breakers map[string]*CB
+	declared map[string]bool
+
+	mutex sync.Mutex
+}
+
+func NewRegistry(defaults CBOptions) *Registry {
+	r := &Registry{
+		defaults: defaults,
+		options:  make(map[string]CBOptions),
+		breakers: make(map[string]*CB),
+		declared: make(map[string]bool),
+	}
+	r.observe()
+	return r
+}
+
+// Configure sets the options of a breaker, before it is first used.
+func (r *Registry) Configure(name string, opt CBOptions) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.options[name] = opt
+}
+
+// Declare the breakers of the dependencies, before one is first used. Only
+// those can be forced.
+func (r *Registry) Declare(names ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, name := range names {
+		r.declared[name] = true
+	}
+}
+
+// Known reports whether the breaker was declared, configured or is in use.
+func (r *Registry) Known(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, configured := r.options[name]
+	_, used := r.breakers[name]
+	return r.declared[name] || configured || used
+}
+
+func (r *Registry) known(name string) error {
+	if !r.Known(name) {
+		return fmt.Errorf("%w: %s", ErrUnknownBreaker, name)
+	}
+	return nil
+}
+
+func (r *Registry) Get(name string) *CB {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if cb, ok := r.breakers[name]; ok {
+		return cb
+	}
+
+	opt, ok := r.options[name]
+	if !ok {
+		opt = r.defaults
+	}
+
+	if len(opt.Name) == 0 {
+		opt.Name = name
+	}
+
+	// Every breaker can be forced.
+	if opt.Overrides == nil {
+		opt.Overrides = r.defaults.Overrides
+	}
+
+	cb := NewCircuitBreaker(opt)
+	r.breakers[name] = cb
+	return cb
+}
+
+// Names of the breakers in use, sorted.
+func (r *Registry) Names() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	names := make([]string, 0, len(r.breakers))
+	for name := range r.breakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BreakerHealth is a breaker as shown in the health output.
+type BreakerHealth struct {
+	Name         string    `json:"name"`
+	State        State     `json:"state"`
+	Fails        uint64    `json:"fails"`
+	OpenInterval string    `json:"open_interval,omitempty"`
+	RetryIn      string    `json:"retry_in,omitempty"`
+	Forced       *Override `json:"forced,omitempty"`
+}
+
+// Health lists the breakers in use on this replica.
+func (r *Registry) Health() []BreakerHealth {
+	var health []BreakerHealth
+	for _, name := range r.Names() {
+		cb := r.Get(name)
+		h := BreakerHealth{
+			Name:   name,
+			State:  cb.State(),
+			Fails:  cb.Fails(),
+			Forced: cb.Override(),
+		}
+		if h.State != closed {
+			if h.Forced == nil {
+				h.OpenInterval = cb.OpenInterval().String()
+			}
+			h.RetryIn = cb.RetryIn().String()
+		}
+		health = append(health, h)
+	}
+	return health
+}
@@ -0,0 +1,201 @@
+package circuitbreaker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+//----------------------------------------------
+// Shared state.
+//---------------------------------------------
+
+const (
+	// STORE_TIMEOUT bounds every call to the store, the breaker falls back to
+	// its local state when it is exceeded.
+	STORE_TIMEOUT = 100 * time.Millisecond
+
+	DEFAULT_SYNC_INTERVAL = time.Second
+)
+
+// SharedState is the state of a breaker as seen by every replica. It is only
+// ever "open" or "closed", each replica moves to "half-open" on its own once
+// the open interval is over.
+type SharedState struct {
+	State State
+	// ChangedAt is when State last changed, the newest change wins.
+	ChangedAt time.Time
+	// Fails is the number of consecutive fails in the "Closed" state.
+	Fails uint64
+}
+
+// Store shares the state of the breakers across replicas, so a failing
+// dependency opens the circuit everywhere at once.
+type Store interface {
+	Load(ctx context.Context, name string) (SharedState, error)
+
+	// SetState publishes a transition and resets the fails. Older transitions
+	// than the stored one are ignored.
+	SetState(ctx context.Context, name string, state State, changedAt time.Time) error
+
+	// AddFail counts a failed request and returns the fails of every replica.
+	AddFail(ctx context.Context, name string) (uint64, error)
+
+	ResetFails(ctx context.Context, name string) error
+}
+
+// refresh loads the shared state and the override, at most once per sync
+// interval. The store is called without the mutex, a slow store doesn't hold
+// the other requests up. It returns the transitions it made.
+func (cb *CB) refresh() []Transition {
+	if cb.store == nil && cb.overrides == nil {
+		return nil
+	}
+
+	cb.mutex.Lock()
+	now := cb.clock.Now()
+	if !cb.syncedAt.IsZero() && now.Sub(cb.syncedAt) < cb.syncInterval {
+		cb.mutex.Unlock()
+		return nil
+	}
+	cb.syncedAt = now
+	cb.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), STORE_TIMEOUT)
+	defer cancel()
+
+	var override *Override
+	var overrideErr error
+	if cb.overrides != nil {
+		override, overrideErr = cb.overrides.LoadOverride(ctx, cb.name)
+	}
+
+	var shared SharedState
+	var sharedErr error
+	if cb.store != nil {
+		shared, sharedErr = cb.store.Load(ctx, cb.name)
+	}
+
+	cb.mutex.Lock()
+	if cb.overrides != nil && !cb.storeFailed(overrideErr) {
+		cb.applyOverride(override)
+	}
+	if cb.store != nil && !cb.storeFailed(sharedErr) {
+		cb.adopt(shared)
+	}
+	return cb.unlock()
+}
+
+// adopt takes the shared state if it changed after the local one. Must be
+// called with the mutex held.
+func (cb *CB) adopt(shared SharedState) {
+	if shared.ChangedAt.After(cb.changedAt) {
+		switch shared.State {
+		case open:
+			cb.open(shared.ChangedAt)
+		case closed:
+			cb.close(shared.ChangedAt)
+		}
+	}
+
+	// NOTE(Appy): The sliding window stays local, only its trips are shared.
+	if cb.state == closed && cb.window == nil {
+		cb.fails = shared.Fails
+	}
+}
+
+// later queues a call to the store, run by unlock() once the mutex is
+// released. The call takes the mutex again to apply its result. Must be
+// called with the mutex held.
+func (cb *CB) later(call func(ctx context.Context) error, apply func(err error)) {
+	cb.calls = append(cb.calls, func() []Transition {
+		ctx, cancel := context.WithTimeout(context.Background(), STORE_TIMEOUT)
+		err := call(ctx)
+		cancel()
+
+		cb.mutex.Lock()
+		apply(err)
+		return cb.unlock()
+	})
+}
+
+// publish shares a transition made by this replica. Must be called with the
+// mutex held.
+func (cb *CB) publish() {
+	if cb.store == nil || cb.storeDown {
+		return
+	}
+
+	state, changedAt := cb.state, cb.changedAt
+	cb.later(func(ctx context.Context) error {
+		return cb.store.SetState(ctx, cb.name, state, changedAt)
+	}, func(err error) {
+		cb.storeFailed(err)
+	})
+}
+
+// addFail counts a failed request and trips the circuit once there are too
+// many. With the store up, the fails of every replica count once it answers.
+// Must be called with the mutex held.
+func (cb *CB) addFail() {
+	cb.fails++
+	if cb.fails >= cb.maxConsecutiveFails {
+		cb.trip()
+		return
+	}
+
+	if cb.store == nil || cb.storeDown {
+		return
+	}
+
+	var fails uint64
+	changedAt := cb.changedAt
+	cb.later(func(ctx context.Context) (err error) {
+		fails, err = cb.store.AddFail(ctx, cb.name)
+		return err
+	}, func(err error) {
+		if cb.storeFailed(err) {
+			return
+		}
+
+		// The count is stale once the circuit changed state meanwhile.
+		if cb.state != closed || !cb.changedAt.Equal(changedAt) || fails <= cb.fails {
+			return
+		}
+		cb.fails = fails
+		if cb.fails >= cb.maxConsecutiveFails {
+			cb.trip()
+		}
+	})
+}
+
+// resetFails clears the fails of every replica after a success. Must be
+// called with the mutex held.
+func (cb *CB) resetFails() {
+	if cb.fails > 0 && cb.store != nil && !cb.storeDown {
+		cb.later(func(ctx context.Context) error {
+			return cb.store.ResetFails(ctx, cb.name)
+		}, func(err error) {
+			cb.storeFailed(err)
+		})
+	}
+	cb.fails = 0
+}
+
+// storeFailed reports whether the store call failed. A failed store is left
+// alone until the next sync, the breaker only counts on this replica meanwhile.
+func (cb *CB) storeFailed(err error) bool {
+	if err != nil {
+		if !cb.storeDown {
+			log.Printf("Circuit breaker %s: store unavailable, using local state: %v\n", cb.name, err)
+		}
+		cb.storeDown = true
+		return true
+	}
+
+	if cb.storeDown {
+		log.Printf("Circuit breaker %s: store is back, sharing state\n", cb.name)
+	}
+	cb.storeDown = false
+	return false
+}
@@ -13,6 +13,10 @@ func TimeToPointer(x time.Duration) *time.Duration {
 	return &x
 }
 
+func FloatToPointer(x float64) *float64 {
+	return &x
+}
+
 func StringToState(str string) (State, bool) {
 	c, ok := states[strings.ToLower(str)]
 	return c, ok
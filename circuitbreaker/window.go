@@ -0,0 +1,147 @@
+package circuitbreaker
+
+import "time"
+
+type WindowType string
+
+const (
+	// Trips on MaxConsecutiveFails consecutive fails, the default.
+	WINDOW_NONE WindowType = ""
+	// Keeps the outcome of the last WindowSize calls.
+	WINDOW_COUNT WindowType = "count"
+	// Keeps the outcome of the calls of the last WindowDuration, per second.
+	WINDOW_TIME WindowType = "time"
+)
+
+type outcome struct {
+	failed bool
+	slow   bool
+}
+
+type windowCounts struct {
+	calls uint64
+	fails uint64
+	slow  uint64
+}
+
+func (c *windowCounts) add(o outcome) {
+	c.calls++
+	if o.failed {
+		c.fails++
+	}
+	if o.slow {
+		c.slow++
+	}
+}
+
+func (c *windowCounts) sub(o outcome) {
+	c.calls--
+	if o.failed {
+		c.fails--
+	}
+	if o.slow {
+		c.slow--
+	}
+}
+
+// window aggregates the outcome of the recent calls. Not synchronized, the
+// breaker holds its mutex.
+type window interface {
+	record(o outcome, now time.Time)
+	counts(now time.Time) windowCounts
+	reset()
+}
+
+// countWindow is a ring buffer of the last outcomes.
+type countWindow struct {
+	outcomes []outcome
+	next     int
+	full     bool
+	total    windowCounts
+}
+
+func newCountWindow(size uint64) *countWindow {
+	return &countWindow{outcomes: make([]outcome, size)}
+}
+
+func (w *countWindow) record(o outcome, now time.Time) {
+	if w.full {
+		w.total.sub(w.outcomes[w.next])
+	}
+
+	w.outcomes[w.next] = o
+	w.total.add(o)
+
+	w.next++
+	if w.next == len(w.outcomes) {
+		w.next = 0
+		w.full = true
+	}
+}
+
+func (w *countWindow) counts(now time.Time) windowCounts {
+	return w.total
+}
+
+func (w *countWindow) reset() {
+	w.next = 0
+	w.full = false
+	w.total = windowCounts{}
+}
+
+// timeWindow keeps one bucket per second.
+type timeWindow struct {
+	buckets []windowCounts
+	seconds []int64 // Second each bucket holds.
+}
+
+func newTimeWindow(duration time.Duration) *timeWindow {
+	size := int(duration / time.Second)
+	if size < 1 {
+		size = 1
+	}
+
+	return &timeWindow{
+		buckets: make([]windowCounts, size),
+		seconds: make([]int64, size),
+	}
+}
+
+func (w *timeWindow) bucket(now time.Time) *windowCounts {
+	second := now.Unix()
+	i := int(second % int64(len(w.buckets)))
+
+	// The bucket held an older second, start over.
+	if w.seconds[i] != second {
+		w.seconds[i] = second
+		w.buckets[i] = windowCounts{}
+	}
+
+	return &w.buckets[i]
+}
+
+func (w *timeWindow) record(o outcome, now time.Time) {
+	w.bucket(now).add(o)
+}
+
+func (w *timeWindow) counts(now time.Time) windowCounts {
+	var total windowCounts
+	oldest := now.Unix() - int64(len(w.buckets))
+
+	for i, b := range w.buckets {
+		if w.seconds[i] > oldest {
+			total.calls += b.calls
+			total.fails += b.fails
+			total.slow += b.slow
+		}
+	}
+
+	return total
+}
+
+func (w *timeWindow) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = windowCounts{}
+		w.seconds[i] = 0
+	}
+}
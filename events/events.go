@@ -0,0 +1,137 @@
+// Package events publishes the payment domain events to a Redis Stream.
+//
+// Every stream entry has the fields:
+//   - event_id: unique per event, the same payment always gets the same ID, so
+//     consumers can drop an event published twice.
+//   - type: "payment.charged", "payment.refunded" or "payment.failed", see
+//     PAYMENT_CHARGED, PAYMENT_REFUNDED and PAYMENT_FAILED.
+//   - version: schema version of data.
+//   - traceparent / tracestate: W3C trace context of the saga.
+//   - data: the json PaymentEvent.
+//
+// The entry IDs are generated by Redis, consumer groups read the stream with
+// XREADGROUP as usual.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	PAYMENT_CHARGED  = "payment.charged"
+	PAYMENT_REFUNDED = "payment.refunded"
+	PAYMENT_FAILED   = "payment.failed"
+
+	SCHEMA_VERSION = 1
+
+	DEFAULT_STREAM = "payments"
+
+	// The stream is trimmed to roughly this many entries.
+	STREAM_MAX_LEN = 100000
+)
+
+// PaymentEvent is the data of a stream entry, schema version 1.
+type PaymentEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	OccurredAt time.Time `json:"occurred_at"`
+
+	SagaID   string `json:"saga_id,omitempty"`
+	OrderID  uint   `json:"order_id"`
+	Username string `json:"username"`
+	TokenID  uint   `json:"token_id"`
+	Amount   uint   `json:"amount"`           // Number of tokens.
+	Total    string `json:"total,omitempty"`  // Decimal, unset if the payment failed before it was priced.
+	Reason   string `json:"reason,omitempty"` // Set on PAYMENT_FAILED.
+
+	TraceCarrier propagation.MapCarrier `json:"trace_carrier,omitempty"`
+}
+
+func NewEventID(eventType string, sagaKey string) string {
+	return fmt.Sprintf("%s:%s", eventType, sagaKey)
+}
+
+type Publisher struct {
+	redis  *redis.Client
+	stream string
+}
+
+func NewPublisher(redisClient *redis.Client, stream string) *Publisher {
+	if len(stream) == 0 {
+		stream = DEFAULT_STREAM
+	}
+
+	return &Publisher{
+		redis:  redisClient,
+		stream: stream,
+	}
+}
+
+// Stamp sets the schema version, the time and the trace context of the event.
+func (e *PaymentEvent) Stamp(ctx context.Context) {
+	e.Version = SCHEMA_VERSION
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+
+	e.TraceCarrier = make(propagation.MapCarrier)
+	otel.GetTextMapPropagator().Inject(ctx, e.TraceCarrier)
+}
+
+// Publish appends the event to the stream. The trace context is taken from ctx
+// if the event isn't stamped yet.
+func (p *Publisher) Publish(ctx context.Context, event PaymentEvent) error {
+	if event.Version == 0 {
+		event.Stamp(ctx)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{
+		"event_id": event.ID,
+		"type":     event.Type,
+		"version":  event.Version,
+		"data":     data,
+	}
+	for _, key := range []string{"traceparent", "tracestate"} {
+		if val := event.TraceCarrier.Get(key); len(val) > 0 {
+			values[key] = val
+		}
+	}
+
+	return p.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		MaxLen: STREAM_MAX_LEN,
+		Approx: true,
+		Values: values,
+	}).Err()
+}
+
+// Decode reads the event of a stream entry.
+func Decode(message redis.XMessage) (PaymentEvent, error) {
+	var event PaymentEvent
+
+	version, _ := message.Values["version"].(string)
+	if v, err := strconv.Atoi(version); err != nil || v > SCHEMA_VERSION {
+		return event, fmt.Errorf("Unsupported event version: %q", version)
+	}
+
+	data, _ := message.Values["data"].(string)
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return event, err
+	}
+
+	return event, nil
+}
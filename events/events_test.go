@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPublishDecode(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+	traceID, _ := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	spanID, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	event := PaymentEvent{
+		ID:         NewEventID(PAYMENT_CHARGED, "saga-42"),
+		Type:       PAYMENT_CHARGED,
+		OccurredAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		SagaID:     "saga-42",
+		OrderID:    42,
+		Username:   "appy",
+		TokenID:    7,
+		Amount:     3,
+		Total:      "29.97",
+	}
+
+	// Published twice, such as by a retried step.
+	publisher := NewPublisher(client, "")
+	for i := 0; i < 2; i++ {
+		if err := publisher.Publish(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages, err := client.XRange(context.Background(), DEFAULT_STREAM, "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("%d entries, want 2", len(messages))
+	}
+
+	want := event
+	want.Version = SCHEMA_VERSION
+	want.TraceCarrier = propagation.MapCarrier{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+
+	for _, message := range messages {
+		// Consumers drop the duplicates on the event_id field.
+		if got := message.Values["event_id"]; got != "payment.charged:saga-42" {
+			t.Errorf("event_id %v, want payment.charged:saga-42", got)
+		}
+		if got := message.Values["type"]; got != "payment.charged" {
+			t.Errorf("type %v, want payment.charged", got)
+		}
+		if got := message.Values["traceparent"]; got != want.TraceCarrier["traceparent"] {
+			t.Errorf("traceparent %v, want %s", got, want.TraceCarrier["traceparent"])
+		}
+
+		got, err := Decode(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("decoded %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestDecodeNewerVersion(t *testing.T) {
+	message := redis.XMessage{Values: map[string]interface{}{"version": "2", "data": "{}"}}
+	if _, err := Decode(message); err == nil {
+		t.Error("decoded an unsupported version")
+	}
+}
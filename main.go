@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"log"
+	"os"
 
 	"github.com/alex-appy-love-story/worker-template/app"
+	"github.com/alex-appy-love-story/worker-template/ordersvc"
 	"github.com/joho/godotenv"
 )
 
@@ -15,6 +17,26 @@ func printNumber(n int) int {
 func main() {
 	godotenv.Load()
 
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	// Commands that don't need a config.
+	switch command {
+	case "order-status-server":
+		// Local stand-in for the gRPC order service.
+		addr := "localhost:5002"
+		if len(os.Args) > 2 {
+			addr = os.Args[2]
+		}
+		if err := ordersvc.ServeLocal(addr, ordersvc.NewFake()); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	config, err := app.LoadConfig()
 
 	if err != nil {
@@ -23,6 +45,26 @@ func main() {
 
 	app := app.New(*config)
 
-	app.Start(context.Background())
+	switch command {
+	case "webhooks":
+		if err := app.WebhookCommand(os.Args[2:]); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+	case "breakers":
+		if err := app.BreakerCommand(os.Args[2:]); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+	case "dead-letters":
+		if err := app.DeadLetters(os.Args[2:]); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+	case "orchestrator":
+		app.StartOrchestrator(context.Background())
+	default:
+		app.Start(context.Background())
+	}
 
 }
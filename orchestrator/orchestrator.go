@@ -0,0 +1,442 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/ordersvc"
+	"github.com/alex-appy-love-story/worker-template/tasks"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// How often the timed out steps are looked for.
+	SWEEP_INTERVAL = time.Second
+
+	// Times an event is applied to a saga which keeps changing concurrently.
+	UPDATE_ATTEMPTS = 5
+)
+
+var (
+	tracer     = otel.Tracer("orchestrator")
+	propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+)
+
+type Config struct {
+	// Queue the orchestrator receives saga requests and step replies on.
+	Queue string
+
+	// Steps are the server queues of the steps, in the order they are performed.
+	Steps []string
+
+	// StepTimeout is how long a step has to reply before it is retried or compensated.
+	StepTimeout time.Duration
+
+	// MaxAttempts is the number of times a step is dispatched before giving up.
+	MaxAttempts int
+
+	OrderClient ordersvc.OrderClient
+
+	// ContentType and SchemaVersion the steps are dispatched with.
+	ContentType   string
+	SchemaVersion int
+
+	// SagaTimeout is the end-to-end deadline of a saga, used when the request has none.
+	SagaTimeout time.Duration
+}
+
+// Orchestrator drives sagas from one place instead of letting every step chain
+// to the next one. Each step is dispatched with a reply queue and reports back
+// through a "task:reply" task, the orchestrator then decides what runs next.
+//
+// The sagas are kept in the store, so any replica can handle the next event of
+// a saga, and the calls an event leads to are only made once it is saved.
+type Orchestrator struct {
+	config    Config
+	client    *asynq.Client
+	inspector *asynq.Inspector
+	store     Store
+}
+
+func New(config Config, client *asynq.Client, inspector *asynq.Inspector, store Store) *Orchestrator {
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+
+	if config.StepTimeout <= 0 {
+		config.StepTimeout = 10 * time.Second
+	}
+
+	return &Orchestrator{
+		config:    config,
+		client:    client,
+		inspector: inspector,
+		store:     store,
+	}
+}
+
+func (o *Orchestrator) RegisterTopic(mux *asynq.ServeMux) {
+	mux.HandleFunc("task:saga", o.HandleSagaTask)
+	mux.HandleFunc("task:reply", o.HandleReplyTask)
+}
+
+// Run times out the steps which didn't reply in time, until the context is
+// done. Every replica runs it, the store lets a single one handle a timeout.
+func (o *Orchestrator) Run(ctx context.Context) {
+	ticker := time.NewTicker(SWEEP_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sagaIDs, err := o.store.Due(ctx, time.Now())
+		if err != nil {
+			log.Println("Failed to load timed out sagas:", err)
+			continue
+		}
+
+		for _, sagaID := range sagaIDs {
+			if err := o.timeout(ctx, sagaID); err != nil {
+				log.Printf("Failed to time out saga %s: %s\n", sagaID, err)
+			}
+		}
+	}
+}
+
+// update loads the saga and applies the event to it, over again if another
+// replica saved the saga in the meantime. The saga is nil if it isn't in the
+// store, f returns nil to leave it as is.
+func (o *Orchestrator) update(ctx context.Context, sagaID string, event string, f func(s *Saga) *Saga) error {
+	for i := 0; i < UPDATE_ATTEMPTS; i++ {
+		s, err := o.store.Load(ctx, sagaID)
+		if err != nil {
+			return err
+		}
+		if s != nil {
+			s.startSpan(ctx, event)
+		}
+
+		next := f(s)
+		if next != nil {
+			err = o.commit(ctx, next)
+			if next != s {
+				next.span.End()
+			}
+		}
+		if s != nil {
+			s.span.End()
+		}
+
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+
+	return ErrConflict
+}
+
+// commit saves the saga, or deletes it once it is over, then makes the calls
+// the event led to.
+func (o *Orchestrator) commit(ctx context.Context, s *Saga) error {
+	var err error
+	if s.finished {
+		err = o.store.Delete(ctx, s)
+	} else {
+		err = o.store.Save(ctx, s)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, effect := range s.effects {
+		effect()
+	}
+	return nil
+}
+
+// HandleSagaTask starts a new saga. The payload is the same one the first step
+// would receive when the steps are chained together.
+func (o *Orchestrator) HandleSagaTask(ctx context.Context, t *asynq.Task) error {
+	env, err := tasks.DecodeEnvelope(t.Payload())
+	if err != nil {
+		return fmt.Errorf("DecodeEnvelope failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	var payload tasks.OrderMessage
+	if err := env.DecodeBody(&payload); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	if len(o.config.Steps) == 0 {
+		return fmt.Errorf("No steps configured: %w", asynq.SkipRetry)
+	}
+
+	sagaID := env.SagaID
+	if len(sagaID) == 0 {
+		sagaID = uuid.NewString()
+	}
+
+	return o.update(ctx, sagaID, "orchestrator.saga", func(running *Saga) *Saga {
+		if running != nil {
+			log.Println("Saga already running:", sagaID)
+			return nil
+		}
+
+		s := &Saga{
+			ID:           sagaID,
+			Status:       Running,
+			Action:       tasks.PERFORM,
+			Attempt:      1,
+			TraceCarrier: payload.TraceCarrier,
+		}
+
+		// Continue the trace of the caller if there is one, the events of
+		// the saga then continue this span.
+		spanCtx := s.startSpan(ctx, "orchestrator.saga")
+		s.TraceCarrier = make(propagation.MapCarrier)
+		propagator.Inject(spanCtx, s.TraceCarrier)
+
+		// Only the order and the chaos settings are kept, the rest is set on dispatch.
+		s.Payload = payload
+		s.Payload.SagaPayload = tasks.SagaPayload{
+			FailTrigger: payload.FailTrigger,
+			Chaos:       payload.Chaos,
+			Deadline:    payload.Deadline,
+		}
+		s.Payload.StartDeadline(o.config.SagaTimeout)
+
+		s.record("saga started with steps: %s", strings.Join(o.config.Steps, " -> "))
+		o.dispatch(s)
+		return s
+	})
+}
+
+// HandleReplyTask collects the outcome of a step and moves the saga along.
+func (o *Orchestrator) HandleReplyTask(ctx context.Context, t *asynq.Task) error {
+	r, err := tasks.DecodeStepReply(t.Payload())
+	if err != nil {
+		return fmt.Errorf("DecodeStepReply failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	return o.update(ctx, r.SagaID, "orchestrator.reply", func(s *Saga) *Saga {
+		if s == nil {
+			log.Println("Reply for unknown saga:", r.SagaID)
+			return nil
+		}
+
+		if r.Step != o.config.Steps[s.Step] || r.Action != s.Action || r.Attempt != s.Attempt {
+			log.Printf("Saga %s ignoring stale reply: %s.%s attempt %d\n", s.ID, r.Step, r.Action, r.Attempt)
+			return nil
+		}
+
+		switch {
+		case r.Action == tasks.PERFORM && r.Success:
+			s.record("%s performed", r.Step)
+			if r.Payload != nil {
+				sagaPayload := s.Payload.SagaPayload
+				s.Payload = *r.Payload
+				s.Payload.SagaPayload = sagaPayload
+			}
+			o.advance(s)
+		case r.Action == tasks.PERFORM:
+			s.record("%s failed: %s", r.Step, r.Error)
+			o.compensate(s, s.Step-1)
+		case r.Success:
+			s.record("%s reverted", r.Step)
+			o.compensate(s, s.Step-1)
+		default:
+			s.record("%s failed to revert: %s", r.Step, r.Error)
+			o.retry(s)
+		}
+
+		return s
+	})
+}
+
+// timeout is called once the step of the saga is due, if it did not reply
+// within the step timeout.
+func (o *Orchestrator) timeout(ctx context.Context, sagaID string) error {
+	return o.update(ctx, sagaID, "orchestrator.timeout", func(s *Saga) *Saga {
+		// Replied, or timed out by another replica.
+		if s == nil || s.DueAt.After(time.Now()) {
+			return nil
+		}
+
+		action, attempt := s.Action, s.Attempt
+		queue := o.config.Steps[s.Step]
+		started := o.cancelPending(s)
+		s.record("%s.%s timed out (attempt %d, started: %t)", queue, action, attempt, started)
+
+		if action == tasks.REVERT {
+			if s.Attempt < o.config.MaxAttempts {
+				o.retry(s)
+				return s
+			}
+			o.finish(s, Stuck)
+			return s
+		}
+
+		// NOTE(Appy): A perform that was picked up may have committed, we can't
+		// retry it without risking a double charge, so it is compensated as well.
+		// Its revert only refunds if it did charge, see RecordRefund.
+		if started {
+			o.failOrder(s)
+			o.compensate(s, s.Step)
+			return s
+		}
+
+		if s.Attempt < o.config.MaxAttempts && !s.Payload.Expired() {
+			o.retry(s)
+			return s
+		}
+
+		o.failOrder(s)
+		o.compensate(s, s.Step-1)
+		return s
+	})
+}
+
+// cancelPending removes the dispatched task if no step picked it up yet.
+// Returns true if the task was started (or its state is unknown).
+func (o *Orchestrator) cancelPending(s *Saga) bool {
+	if len(s.TaskID) == 0 {
+		// Never enqueued.
+		return false
+	}
+
+	queue := o.config.Steps[s.Step]
+	taskInfo, err := o.inspector.GetTaskInfo(queue, s.TaskID)
+	if err != nil {
+		return true
+	}
+
+	switch taskInfo.State {
+	case asynq.TaskStatePending, asynq.TaskStateScheduled, asynq.TaskStateRetry:
+		if err := o.inspector.DeleteTask(queue, s.TaskID); err != nil {
+			log.Println("Failed to delete task:", s.TaskID)
+			return true
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func (o *Orchestrator) advance(s *Saga) {
+	s.Step++
+	if s.Step == len(o.config.Steps) {
+		o.finish(s, Completed)
+		return
+	}
+
+	s.Action = tasks.PERFORM
+	s.Attempt = 1
+	o.dispatch(s)
+}
+
+// compensate reverts the steps from the given index down to the first one.
+func (o *Orchestrator) compensate(s *Saga, from int) {
+	s.Status = Compensating
+	if from < 0 {
+		o.finish(s, Compensated)
+		return
+	}
+
+	s.Step = from
+	s.Action = tasks.REVERT
+	s.Attempt = 1
+	o.dispatch(s)
+}
+
+func (o *Orchestrator) retry(s *Saga) {
+	s.Attempt++
+	o.dispatch(s)
+}
+
+func (o *Orchestrator) dispatch(s *Saga) {
+	queue := o.config.Steps[s.Step]
+	action, attempt := s.Action, s.Attempt
+
+	// NOTE(Appy): Due even if enqueuing fails, the timeout handles retries.
+	s.DueAt = time.Now().Add(o.config.StepTimeout)
+
+	body := s.Payload
+	body.ReplyQueue = o.config.Queue
+	body.Attempt = attempt
+	body.TraceCarrier = s.TraceCarrier
+
+	env, err := tasks.NewEnvelope(o.config.SchemaVersion, o.config.ContentType, s.ID, o.config.Queue, body)
+	if err != nil {
+		s.record("failed to marshal payload for %s: %s", queue, err.Error())
+		return
+	}
+
+	p, err := env.Marshal()
+	if err != nil {
+		s.record("failed to marshal payload for %s: %s", queue, err.Error())
+		return
+	}
+
+	task := asynq.NewTask(fmt.Sprintf("task:%s", action), p, asynq.MaxRetry(0))
+
+	// NOTE(Appy): Every attempt gets its own task ID, a retry must not be deduplicated.
+	taskID := tasks.StepTaskID(s.ID, queue, fmt.Sprintf("%s:%d", action, attempt))
+
+	opts := []asynq.Option{asynq.Queue(queue), asynq.MaxRetry(0), asynq.TaskID(taskID)}
+	if action == tasks.PERFORM {
+		opts = append(opts, s.Payload.DeadlineOptions()...)
+	}
+
+	s.TaskID = taskID
+	s.record("dispatching %s.%s (attempt %d, task %s)", queue, action, attempt, taskID)
+
+	s.after(func() {
+		_, err := o.client.Enqueue(task, opts...)
+		if err != nil && !tasks.IsDuplicate(err) {
+			log.Printf("Saga %s failed to enqueue %s.%s: %s\n", s.ID, queue, action, err)
+		}
+	})
+}
+
+func (o *Orchestrator) finish(s *Saga, status SagaStatus) {
+	s.Status = status
+	s.finished = true
+	s.record("saga %s", status)
+
+	if status == Completed {
+		s.span.SetStatus(codes.Ok, "")
+	} else {
+		s.span.SetStatus(codes.Error, string(status))
+	}
+
+	s.after(func() {
+		if status == Completed {
+			if err := o.config.OrderClient.SetSucceeded(s.traceContext(), s.Payload.OrderID); err != nil {
+				log.Printf("Saga %s failed to set order status: %s\n", s.ID, err)
+			}
+		}
+		log.Printf("Saga %s %s:\n\t%s\n", s.ID, status, strings.Join(s.History, "\n\t"))
+	})
+}
+
+// failOrder sets the order status when no step was able to do it.
+func (o *Orchestrator) failOrder(s *Saga) {
+	s.after(func() {
+		if err := o.config.OrderClient.SetFailed(s.traceContext(), s.Payload.OrderID, order.FAIL); err != nil {
+			log.Printf("Saga %s failed to set order status: %s\n", s.ID, err)
+		}
+	})
+}
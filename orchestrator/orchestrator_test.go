@@ -0,0 +1,188 @@
+package orchestrator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/ordersvc"
+	"github.com/alex-appy-love-story/worker-template/tasks"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hibiken/asynq"
+)
+
+type testOrchestrator struct {
+	*Orchestrator
+
+	fake      *ordersvc.Fake
+	inspector *asynq.Inspector
+}
+
+func newTestOrchestrator(t *testing.T, stepTimeout time.Duration, maxAttempts int) *testOrchestrator {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := asynq.NewClient(asynq.RedisClientOpt{Addr: mr.Addr()})
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		client.Close()
+		inspector.Close()
+	})
+
+	fake := ordersvc.NewFake()
+	o := New(Config{
+		Queue:         "orchestrator",
+		Steps:         []string{"inventory", "payment"},
+		StepTimeout:   stepTimeout,
+		MaxAttempts:   maxAttempts,
+		OrderClient:   fake,
+		SchemaVersion: tasks.SCHEMA_V1,
+		ContentType:   tasks.CONTENT_TYPE_JSON,
+	}, client, inspector, newTestStore(t, mr))
+
+	return &testOrchestrator{Orchestrator: o, fake: fake, inspector: inspector}
+}
+
+func (o *testOrchestrator) start(t *testing.T) {
+	t.Helper()
+
+	env, err := tasks.NewEnvelope(tasks.SCHEMA_V1, tasks.CONTENT_TYPE_JSON, "saga-42", "", tasks.OrderMessage{OrderID: 42, Amount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := env.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.HandleSagaTask(context.Background(), asynq.NewTask("task:saga", payload)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (o *testOrchestrator) reply(t *testing.T, step string, action string, attempt int, success bool) {
+	t.Helper()
+
+	env, err := tasks.NewEnvelope(tasks.SCHEMA_V1, tasks.CONTENT_TYPE_JSON, "saga-42", step, tasks.StepReply{
+		Action:  action,
+		Attempt: attempt,
+		Success: success,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := env.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.HandleReplyTask(context.Background(), asynq.NewTask("task:reply", payload)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectDispatched checks the saga waits on the step, and its task is queued.
+func (o *testOrchestrator) expectDispatched(t *testing.T, step string, action string, attempt int) {
+	t.Helper()
+
+	s, err := o.store.Load(context.Background(), "saga-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s == nil {
+		t.Fatalf("saga over, want %s.%s", step, action)
+	}
+	if o.config.Steps[s.Step] != step || s.Action != action || s.Attempt != attempt {
+		t.Fatalf("saga at %s.%s attempt %d, want %s.%s attempt %d", o.config.Steps[s.Step], s.Action, s.Attempt, step, action, attempt)
+	}
+
+	taskInfo, err := o.inspector.GetTaskInfo(step, s.TaskID)
+	if err != nil {
+		t.Fatalf("task %s: %v", s.TaskID, err)
+	}
+	if taskInfo.Type != "task:"+action || taskInfo.State != asynq.TaskStatePending {
+		t.Errorf("task %s %s, want a pending task:%s", taskInfo.Type, taskInfo.State, action)
+	}
+}
+
+func (o *testOrchestrator) expectOver(t *testing.T, updates ...order.OrderStatus) {
+	t.Helper()
+
+	if s, _ := o.store.Load(context.Background(), "saga-42"); s != nil {
+		t.Fatalf("saga still %s at step %d", s.Status, s.Step)
+	}
+	if got := o.fake.Updates(42); !reflect.DeepEqual(got, updates) && len(got)+len(updates) > 0 {
+		t.Errorf("order 42: %v, want %v", got, updates)
+	}
+}
+
+func TestForward(t *testing.T) {
+	o := newTestOrchestrator(t, time.Minute, 1)
+
+	o.start(t)
+	o.expectDispatched(t, "inventory", tasks.PERFORM, 1)
+
+	o.reply(t, "inventory", tasks.PERFORM, 1, true)
+	o.expectDispatched(t, "payment", tasks.PERFORM, 1)
+
+	// A late duplicate of the reply doesn't move the saga.
+	o.reply(t, "inventory", tasks.PERFORM, 1, true)
+	o.expectDispatched(t, "payment", tasks.PERFORM, 1)
+
+	o.reply(t, "payment", tasks.PERFORM, 1, true)
+	o.expectOver(t, order.SUCCESS)
+}
+
+func TestCompensation(t *testing.T) {
+	o := newTestOrchestrator(t, time.Minute, 2)
+
+	o.start(t)
+	o.reply(t, "inventory", tasks.PERFORM, 1, true)
+	o.reply(t, "payment", tasks.PERFORM, 1, false)
+	o.expectDispatched(t, "inventory", tasks.REVERT, 1)
+
+	// A failed revert is retried.
+	o.reply(t, "inventory", tasks.REVERT, 1, false)
+	o.expectDispatched(t, "inventory", tasks.REVERT, 2)
+
+	// The failed step set the order status itself.
+	o.reply(t, "inventory", tasks.REVERT, 2, true)
+	o.expectOver(t)
+}
+
+func TestTimeout(t *testing.T) {
+	o := newTestOrchestrator(t, time.Millisecond, 2)
+	ctx := context.Background()
+
+	o.start(t)
+	first, _ := o.store.Load(ctx, "saga-42")
+
+	sweep := func() {
+		t.Helper()
+		time.Sleep(5 * time.Millisecond)
+
+		due, err := o.store.Due(ctx, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 1 || due[0] != "saga-42" {
+			t.Fatalf("due %v, want saga-42", due)
+		}
+		if err := o.timeout(ctx, "saga-42"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nobody picked up the step, it is cancelled and dispatched again.
+	sweep()
+	o.expectDispatched(t, "inventory", tasks.PERFORM, 2)
+	if _, err := o.inspector.GetTaskInfo("inventory", first.TaskID); err == nil {
+		t.Error("timed out task still queued")
+	}
+
+	// Out of attempts, the order fails and there is nothing to compensate.
+	sweep()
+	o.expectOver(t, order.FAIL)
+}
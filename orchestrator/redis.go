@@ -0,0 +1,135 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	STORE_KEY_PREFIX = "orchestrator"
+
+	// Most timed out sagas handled per sweep.
+	DUE_BATCH = 100
+)
+
+// Writes the saga if its version didn't change since it was loaded.
+var saveScript = redis.NewScript(`
+local version = tonumber(redis.call('HGET', KEYS[1], 'version') or '0')
+if version ~= tonumber(ARGV[1]) then
+	return -1
+end
+redis.call('HSET', KEYS[1], 'version', version + 1, 'data', ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[4])
+return version + 1
+`)
+
+var deleteScript = redis.NewScript(`
+local version = tonumber(redis.call('HGET', KEYS[1], 'version') or '0')
+if version ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('ZREM', KEYS[2], ARGV[2])
+return 1
+`)
+
+// RedisStore keeps each saga in a hash, and the step timeouts in a sorted set:
+//
+//	orchestrator:<queue>:saga:<id> version, data (Saga)
+//	orchestrator:<queue>:due       saga IDs, by DueAt (unix ms)
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore keeps the sagas of the orchestrator serving the given queue.
+func NewRedisStore(client *redis.Client, queue string) *RedisStore {
+	return &RedisStore{
+		client: client,
+		prefix: fmt.Sprintf("%s:%s", STORE_KEY_PREFIX, queue),
+	}
+}
+
+func (s *RedisStore) sagaKey(sagaID string) string {
+	return fmt.Sprintf("%s:saga:%s", s.prefix, sagaID)
+}
+
+func (s *RedisStore) dueKey() string {
+	return s.prefix + ":due"
+}
+
+func (s *RedisStore) Load(ctx context.Context, sagaID string) (*Saga, error) {
+	fields, err := s.client.HMGet(ctx, s.sagaKey(sagaID), "version", "data").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	version, _ := fields[0].(string)
+	data, _ := fields[1].(string)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	saga := &Saga{}
+	if err := json.Unmarshal([]byte(data), saga); err != nil {
+		return nil, err
+	}
+
+	saga.Version, err = strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return saga, nil
+}
+
+func (s *RedisStore) Save(ctx context.Context, saga *Saga) error {
+	data, err := json.Marshal(saga)
+	if err != nil {
+		return err
+	}
+
+	version, err := saveScript.Run(ctx, s.client,
+		[]string{s.sagaKey(saga.ID), s.dueKey()},
+		saga.Version, data, saga.DueAt.UnixMilli(), saga.ID).Int64()
+	if err != nil {
+		return err
+	}
+	if version < 0 {
+		return ErrConflict
+	}
+
+	saga.Version = version
+	return nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, saga *Saga) error {
+	deleted, err := deleteScript.Run(ctx, s.client,
+		[]string{s.sagaKey(saga.ID), s.dueKey()},
+		saga.Version, saga.ID).Int()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *RedisStore) Due(ctx context.Context, now time.Time) ([]string, error) {
+	sagaIDs, err := s.client.ZRangeByScore(ctx, s.dueKey(), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: DUE_BATCH,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return sagaIDs, err
+}
@@ -0,0 +1,98 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestStore(t *testing.T, mr *miniredis.Miniredis) *RedisStore {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client, "orchestrator")
+}
+
+func TestRedisStore(t *testing.T) {
+	store := newTestStore(t, miniredis.RunT(t))
+	ctx := context.Background()
+	now := time.Now()
+
+	if s, err := store.Load(ctx, "saga-42"); s != nil || err != nil {
+		t.Fatalf("unknown saga: got %v, %v", s, err)
+	}
+
+	saga := &Saga{ID: "saga-42", Status: Running, Step: 1, DueAt: now.Add(time.Second)}
+	if err := store.Save(ctx, saga); err != nil {
+		t.Fatal(err)
+	}
+	if saga.Version != 1 {
+		t.Errorf("version %d, want 1", saga.Version)
+	}
+
+	loaded, err := store.Load(ctx, "saga-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Version != 1 || loaded.Step != 1 || loaded.Status != Running {
+		t.Errorf("loaded %+v", loaded)
+	}
+
+	if due, _ := store.Due(ctx, now); len(due) != 0 {
+		t.Errorf("due %v before its timeout", due)
+	}
+	if due, _ := store.Due(ctx, now.Add(time.Second)); len(due) != 1 || due[0] != "saga-42" {
+		t.Errorf("due %v, want saga-42", due)
+	}
+
+	if err := store.Delete(ctx, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := store.Load(ctx, "saga-42"); s != nil {
+		t.Errorf("deleted saga loaded: %+v", s)
+	}
+	if due, _ := store.Due(ctx, now.Add(time.Second)); len(due) != 0 {
+		t.Errorf("deleted saga due: %v", due)
+	}
+}
+
+// Two replicas handling an event of the same saga, the second one loses.
+func TestRedisStoreConflict(t *testing.T) {
+	store := newTestStore(t, miniredis.RunT(t))
+	ctx := context.Background()
+
+	if err := store.Save(ctx, &Saga{ID: "saga-42", Status: Running}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := store.Load(ctx, "saga-42")
+	second, _ := store.Load(ctx, "saga-42")
+
+	first.Step = 1
+	if err := store.Save(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	second.Status = Compensating
+	if err := store.Save(ctx, second); !errors.Is(err, ErrConflict) {
+		t.Errorf("save: got %v, want ErrConflict", err)
+	}
+	if err := store.Delete(ctx, second); !errors.Is(err, ErrConflict) {
+		t.Errorf("delete: got %v, want ErrConflict", err)
+	}
+
+	// A new saga with the same ID doesn't overwrite the running one.
+	if err := store.Save(ctx, &Saga{ID: "saga-42"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("new saga: got %v, want ErrConflict", err)
+	}
+
+	loaded, _ := store.Load(ctx, "saga-42")
+	if loaded.Version != 2 || loaded.Step != 1 || loaded.Status != Running {
+		t.Errorf("loaded %+v, want the first save", loaded)
+	}
+}
@@ -0,0 +1,86 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alex-appy-love-story/worker-template/tasks"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type SagaStatus string
+
+const (
+	Running      SagaStatus = "running"
+	Compensating SagaStatus = "compensating"
+	Completed    SagaStatus = "completed"
+	Compensated  SagaStatus = "compensated"
+	Stuck        SagaStatus = "stuck" // A revert never succeeded, needs an operator.
+)
+
+// Saga is the orchestrator's view of a single order flowing through the steps.
+// It is kept in the store between the events that move it along.
+type Saga struct {
+	ID     string     `json:"id"`
+	Status SagaStatus `json:"status"`
+
+	// Payload sent to every step, replaced by the payload each step replies with.
+	Payload tasks.OrderMessage `json:"payload"`
+
+	// Step is the index of the step currently being performed or reverted.
+	Step    int    `json:"step"`
+	Action  string `json:"action"`
+	Attempt int    `json:"attempt"`
+	TaskID  string `json:"task_id"`
+
+	// DueAt is when the current step times out.
+	DueAt time.Time `json:"due_at"`
+
+	// History of everything that happened, for debugging.
+	History []string `json:"history"`
+
+	// Trace of the saga, every event handled continues it.
+	TraceCarrier propagation.MapCarrier `json:"trace_carrier"`
+
+	// Version the saga was loaded at, set by the store.
+	Version int64 `json:"-"`
+
+	// Span of the event being handled.
+	span trace.Span
+
+	// Calls made once the saga is saved, such as dispatching the next step.
+	effects []func()
+
+	// Set once the saga is over, it is deleted instead of saved.
+	finished bool
+}
+
+func (s *Saga) record(format string, args ...interface{}) {
+	entry := fmt.Sprintf(format, args...)
+	s.History = append(s.History, fmt.Sprintf("%s %s", time.Now().Format(time.RFC3339Nano), entry))
+	if s.span != nil {
+		s.span.AddEvent(entry)
+	}
+}
+
+// after queues a call until the saga is saved.
+func (s *Saga) after(f func()) {
+	s.effects = append(s.effects, f)
+}
+
+// startSpan starts the span of the event being handled, in the trace of the saga.
+func (s *Saga) startSpan(ctx context.Context, name string) context.Context {
+	if len(s.TraceCarrier) > 0 {
+		ctx = propagator.Extract(ctx, s.TraceCarrier)
+	}
+
+	ctx, s.span = tracer.Start(ctx, name)
+	return ctx
+}
+
+// traceContext carries the span of the event, for calls to other services.
+func (s *Saga) traceContext() context.Context {
+	return trace.ContextWithSpan(context.Background(), s.span)
+}
@@ -0,0 +1,29 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrConflict is returned when saving a saga that was saved by someone else
+// since it was loaded.
+var ErrConflict = errors.New("Saga changed concurrently")
+
+// Store keeps the sagas in flight, so they survive a restart and every
+// replica of the orchestrator can drive them.
+type Store interface {
+	// Load returns nil if the saga is unknown, or already finished.
+	Load(ctx context.Context, sagaID string) (*Saga, error)
+
+	// Save writes the saga, and schedules its step timeout at DueAt. Returns
+	// ErrConflict if the saga was saved since it was loaded.
+	Save(ctx context.Context, s *Saga) error
+
+	// Delete removes a finished saga. Returns ErrConflict if the saga was
+	// saved since it was loaded.
+	Delete(ctx context.Context, s *Saga) error
+
+	// Due returns the sagas whose step timed out by the given time.
+	Due(ctx context.Context, now time.Time) ([]string, error)
+}
@@ -0,0 +1,70 @@
+package ordersvc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/circuitbreaker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrCircuitOpen = errors.New("Order service circuit open")
+
+// breakerClient stops calling the order service while it is failing.
+type breakerClient struct {
+	client OrderClient
+	cb     *circuitbreaker.CB
+}
+
+func WithBreaker(client OrderClient, cb *circuitbreaker.CB) OrderClient {
+	return &breakerClient{client: client, cb: cb}
+}
+
+func (c *breakerClient) SetFailed(ctx context.Context, orderID uint, status order.OrderStatus) error {
+	return c.call(ctx, func() error { return c.client.SetFailed(ctx, orderID, status) })
+}
+
+func (c *breakerClient) SetSucceeded(ctx context.Context, orderID uint) error {
+	return c.call(ctx, func() error { return c.client.SetSucceeded(ctx, orderID) })
+}
+
+func (c *breakerClient) SetRefunded(ctx context.Context, orderID uint) error {
+	return c.call(ctx, func() error { return c.client.SetRefunded(ctx, orderID) })
+}
+
+func (c *breakerClient) Close() error {
+	return c.client.Close()
+}
+
+func (c *breakerClient) call(ctx context.Context, f func() error) error {
+	if !c.cb.AllowContext(ctx) {
+		return ErrCircuitOpen
+	}
+
+	start := time.Now()
+	err := f()
+
+	// A rejected update means the order service is up.
+	c.cb.ReportContext(ctx, err == nil || rejected(err), time.Since(start))
+	return err
+}
+
+// rejected reports whether the order service answered and refused the
+// update, over either transport.
+func rejected(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return !statusErr.Retryable()
+	}
+
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.FailedPrecondition, codes.OutOfRange, codes.Unimplemented, codes.Unauthenticated:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,51 @@
+package ordersvc
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/circuitbreaker"
+	"google.golang.org/grpc/codes"
+)
+
+// A refused update leaves the circuit closed, a failing order service opens it.
+func TestBreakerClient(t *testing.T) {
+	httpClient := func(code int) OrderClient {
+		return newOrderService(t, code).client(1)
+	}
+	grpcClient := func(code codes.Code) OrderClient {
+		return serve(t, &flakyServer{Server: &Server{backend: NewFake()}, fail: []codes.Code{code}}, 1)
+	}
+
+	tests := []struct {
+		name   string
+		client func() OrderClient
+		state  circuitbreaker.State
+	}{
+		{"http 400", func() OrderClient { return httpClient(http.StatusBadRequest) }, "closed"},
+		{"http 409", func() OrderClient { return httpClient(http.StatusConflict) }, "closed"},
+		{"http 503", func() OrderClient { return httpClient(http.StatusServiceUnavailable) }, "open"},
+		{"grpc InvalidArgument", func() OrderClient { return grpcClient(codes.InvalidArgument) }, "closed"},
+		{"grpc NotFound", func() OrderClient { return grpcClient(codes.NotFound) }, "closed"},
+		{"grpc FailedPrecondition", func() OrderClient { return grpcClient(codes.FailedPrecondition) }, "closed"},
+		{"grpc Internal", func() OrderClient { return grpcClient(codes.Internal) }, "open"},
+		{"grpc Unavailable", func() OrderClient { return grpcClient(codes.Unavailable) }, "open"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := circuitbreaker.NewCircuitBreaker(circuitbreaker.CBOptions{
+				MaxConsecutiveFails: circuitbreaker.IntToPointer(1),
+			})
+
+			if err := WithBreaker(tt.client(), cb).SetFailed(context.Background(), 42, order.FAIL); err == nil {
+				t.Fatal("update succeeded")
+			}
+			if got := cb.State(); got != tt.state {
+				t.Errorf("state %s, want %s", got, tt.state)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package ordersvc
+
+import (
+	"context"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/bulkhead"
+)
+
+// bulkheadClient limits the calls in flight to the order service.
+type bulkheadClient struct {
+	client   OrderClient
+	bulkhead *bulkhead.Bulkhead
+}
+
+func WithBulkhead(client OrderClient, b *bulkhead.Bulkhead) OrderClient {
+	return &bulkheadClient{client: client, bulkhead: b}
+}
+
+func (c *bulkheadClient) SetFailed(ctx context.Context, orderID uint, status order.OrderStatus) error {
+	return c.bulkhead.Do(ctx, func() error { return c.client.SetFailed(ctx, orderID, status) })
+}
+
+func (c *bulkheadClient) SetSucceeded(ctx context.Context, orderID uint) error {
+	return c.bulkhead.Do(ctx, func() error { return c.client.SetSucceeded(ctx, orderID) })
+}
+
+func (c *bulkheadClient) SetRefunded(ctx context.Context, orderID uint) error {
+	return c.bulkhead.Do(ctx, func() error { return c.client.SetRefunded(ctx, orderID) })
+}
+
+func (c *bulkheadClient) Close() error {
+	return c.client.Close()
+}
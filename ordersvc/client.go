@@ -0,0 +1,72 @@
+package ordersvc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+)
+
+// REFUNDED is not an order status of its own in db-lib, the order service
+// records it next to the failure.
+const REFUNDED order.OrderStatus = "REFUNDED"
+
+// OrderClient updates the status of orders on the order service.
+type OrderClient interface {
+	// SetFailed fails a pending order, the order service keeps the first failure.
+	SetFailed(ctx context.Context, orderID uint, status order.OrderStatus) error
+
+	// SetSucceeded is called once the whole saga of the order completed.
+	SetSucceeded(ctx context.Context, orderID uint) error
+
+	// SetRefunded records that the payment of the order was refunded.
+	SetRefunded(ctx context.Context, orderID uint) error
+
+	// Close releases the connections to the order service.
+	Close() error
+}
+
+const (
+	TRANSPORT_HTTP = "http"
+	TRANSPORT_GRPC = "grpc"
+)
+
+// New returns the client of the transport.
+func New(transport string, addr string, options Options) (OrderClient, error) {
+	switch transport {
+	case TRANSPORT_HTTP, "":
+		return NewHTTPClient(addr, options), nil
+	case TRANSPORT_GRPC:
+		return NewGRPCClient(addr, options)
+	case TRANSPORT_QUEUE:
+		return NewQueueClient(options.Queue, options.AsynqClient, options.RedisClient), nil
+	default:
+		return nil, fmt.Errorf("Unknown order service transport: %s", transport)
+	}
+}
+
+// StatusError is returned when the order service answers with a non 2xx code.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Order service responded with %d: %s", e.Code, e.Body)
+}
+
+// Retryable reports whether the request may succeed if sent again.
+func (e *StatusError) Retryable() bool {
+	return (e.Code >= 500 && e.Code != http.StatusNotImplemented) || e.Code == http.StatusTooManyRequests
+}
+
+// Unsupported reports whether the order service doesn't serve the endpoint.
+func (e *StatusError) Unsupported() bool {
+	switch e.Code {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,182 @@
+package ordersvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+)
+
+//----------------------------------------------
+// Consumer contract.
+//
+// The order service consumes the "order:status" tasks of the status queue:
+// - The payload is a json StatusUpdate.
+// - Updates of the same order are applied one at a time, in sequence order.
+// - An update with a sequence at or below the last applied one is stale. It
+//   is dropped if the order already went through the same update, or through
+//   one superseding it, and applied otherwise: a failure or a refund retried
+//   past a newer update is never lost, a late success never overrides them.
+// - A failed update is retried by asynq, the sequence is only committed once
+//   the update is applied.
+// - An update finding the order locked by another one is enqueued again
+//   shortly after, it doesn't spend one of its retries.
+//
+// RegisterStatusConsumer implements this contract on top of any OrderClient,
+// typically the order service's own database.
+//---------------------------------------------
+
+const (
+	// How long an update holds the order, longer than applying any update.
+	STATUS_LOCK_TTL = 30 * time.Second
+
+	// How long an update finding the order locked waits before running again.
+	STATUS_LOCK_RETRY_DELAY = time.Second
+)
+
+var ErrOrderLocked = errors.New("Order locked by another status update")
+
+// unlockScript releases the lock of the order only if the update still holds
+// it, an update outliving STATUS_LOCK_TTL never releases the next one's.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func RegisterStatusConsumer(mux *asynq.ServeMux, backend OrderClient, client *asynq.Client, redisClient *redis.Client) {
+	consumer := &statusConsumer{backend: backend, client: client, redis: redisClient}
+	mux.HandleFunc("order:status", consumer.HandleStatusUpdate)
+}
+
+type statusConsumer struct {
+	backend OrderClient
+	client  *asynq.Client
+	redis   *redis.Client
+}
+
+func lockKey(orderID uint) string {
+	return fmt.Sprintf("order:status:lock:%d", orderID)
+}
+
+func appliedKey(orderID uint) string {
+	return fmt.Sprintf("order:status:applied:%d", orderID)
+}
+
+// kindsKey maps the kinds of update applied to the order to their sequence.
+func kindsKey(orderID uint) string {
+	return fmt.Sprintf("order:status:kinds:%d", orderID)
+}
+
+// supersededBy lists the updates after which a stale update of the kind is dropped.
+var supersededBy = map[string][]string{
+	STATUS_FAILED:    {STATUS_FAILED},
+	STATUS_SUCCEEDED: {STATUS_SUCCEEDED, STATUS_FAILED, STATUS_REFUNDED},
+	STATUS_REFUNDED:  {STATUS_REFUNDED},
+}
+
+// stale reports whether the update must be dropped, given the last applied
+// sequence and the kinds applied so far.
+func stale(update StatusUpdate, last int64, kinds map[string]string) bool {
+	if update.Sequence > last {
+		return false
+	}
+
+	for _, kind := range supersededBy[update.Kind] {
+		if _, applied := kinds[kind]; applied {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *statusConsumer) HandleStatusUpdate(ctx context.Context, t *asynq.Task) error {
+	var update StatusUpdate
+	if err := json.Unmarshal(t.Payload(), &update); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	ctx = otel.GetTextMapPropagator().Extract(ctx, update.TraceCarrier)
+
+	// One update of the order at a time, the others run again later.
+	taskID, _ := asynq.GetTaskID(ctx)
+	locked, err := c.redis.SetNX(ctx, lockKey(update.OrderID), taskID, STATUS_LOCK_TTL).Result()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return c.requeue(ctx, t)
+	}
+	defer unlockScript.Run(context.Background(), c.redis, []string{lockKey(update.OrderID)}, taskID)
+
+	applied, err := c.redis.Get(ctx, appliedKey(update.OrderID)).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	kinds, err := c.redis.HGetAll(ctx, kindsKey(update.OrderID)).Result()
+	if err != nil {
+		return err
+	}
+
+	last, _ := strconv.ParseInt(applied, 10, 64)
+	if stale(update, last, kinds) {
+		log.Printf("Dropping stale %s update of order %d: %d <= %d\n", update.Kind, update.OrderID, update.Sequence, last)
+		return nil
+	}
+	if update.Sequence <= last {
+		log.Printf("Applying late %s update of order %d: %d <= %d\n", update.Kind, update.OrderID, update.Sequence, last)
+	}
+
+	if err := c.apply(ctx, update); err != nil {
+		return err
+	}
+
+	// NOTE(Appy): A late update never moves the sequence back.
+	_, err = c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, kindsKey(update.OrderID), update.Kind, update.Sequence)
+		pipe.Expire(ctx, kindsKey(update.OrderID), STATUS_SEQUENCE_TTL)
+		if update.Sequence > last {
+			pipe.Set(ctx, appliedKey(update.OrderID), update.Sequence, STATUS_SEQUENCE_TTL)
+		}
+		return nil
+	})
+	return err
+}
+
+// requeue enqueues the update again after STATUS_LOCK_RETRY_DELAY. Retried by
+// asynq instead, every conflict would spend one of the retries of the update.
+func (c *statusConsumer) requeue(ctx context.Context, t *asynq.Task) error {
+	queue, ok := asynq.GetQueueName(ctx)
+	if !ok {
+		queue = DEFAULT_STATUS_QUEUE
+	}
+
+	_, err := c.client.EnqueueContext(ctx, asynq.NewTask(t.Type(), t.Payload()),
+		asynq.Queue(queue), asynq.MaxRetry(STATUS_MAX_RETRY), asynq.ProcessIn(STATUS_LOCK_RETRY_DELAY))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOrderLocked, err)
+	}
+	return nil
+}
+
+func (c *statusConsumer) apply(ctx context.Context, update StatusUpdate) error {
+	switch update.Kind {
+	case STATUS_FAILED:
+		return c.backend.SetFailed(ctx, update.OrderID, update.Status)
+	case STATUS_SUCCEEDED:
+		return c.backend.SetSucceeded(ctx, update.OrderID)
+	case STATUS_REFUNDED:
+		return c.backend.SetRefunded(ctx, update.OrderID)
+	default:
+		return fmt.Errorf("Unknown status update %q: %w", update.Kind, asynq.SkipRetry)
+	}
+}
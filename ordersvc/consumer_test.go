@@ -0,0 +1,132 @@
+package ordersvc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStale(t *testing.T) {
+	tests := []struct {
+		name   string
+		update StatusUpdate
+		last   int64
+		kinds  map[string]string
+		want   bool
+	}{
+		{"newer", StatusUpdate{Kind: STATUS_SUCCEEDED, Sequence: 3}, 2, map[string]string{STATUS_FAILED: "2"}, false},
+		{"duplicate", StatusUpdate{Kind: STATUS_FAILED, Sequence: 2}, 2, map[string]string{STATUS_FAILED: "2"}, true},
+		{"failure retried past a refund", StatusUpdate{Kind: STATUS_FAILED, Sequence: 1}, 2, map[string]string{STATUS_REFUNDED: "2"}, false},
+		{"refund retried past a failure", StatusUpdate{Kind: STATUS_REFUNDED, Sequence: 1}, 2, map[string]string{STATUS_FAILED: "2"}, false},
+		{"failure retried past a success", StatusUpdate{Kind: STATUS_FAILED, Sequence: 1}, 2, map[string]string{STATUS_SUCCEEDED: "2"}, false},
+		{"success retried past a failure", StatusUpdate{Kind: STATUS_SUCCEEDED, Sequence: 1}, 2, map[string]string{STATUS_FAILED: "2"}, true},
+		{"success retried past a refund", StatusUpdate{Kind: STATUS_SUCCEEDED, Sequence: 1}, 2, map[string]string{STATUS_REFUNDED: "2"}, true},
+		{"sequence expired", StatusUpdate{Kind: STATUS_FAILED, Sequence: 1}, 0, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stale(tt.update, tt.last, tt.kinds); got != tt.want {
+				t.Errorf("stale = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestConsumer(t *testing.T) (*statusConsumer, *Fake, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	client := asynq.NewClient(asynq.RedisClientOpt{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		client.Close()
+		redisClient.Close()
+	})
+
+	fake := NewFake()
+	return &statusConsumer{backend: fake, client: client, redis: redisClient}, fake, mr
+}
+
+func statusTask(t *testing.T, update StatusUpdate) *asynq.Task {
+	t.Helper()
+
+	payload, err := json.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return asynq.NewTask("order:status", payload)
+}
+
+func TestConsumerOutOfOrder(t *testing.T) {
+	c, fake, mr := newTestConsumer(t)
+	ctx := context.Background()
+
+	updates := []StatusUpdate{
+		{OrderID: 42, Kind: STATUS_FAILED, Status: order.FAIL, Sequence: 2},
+		// Superseded by the failure.
+		{OrderID: 42, Kind: STATUS_SUCCEEDED, Sequence: 1},
+		// Retried past the failure, still applied.
+		{OrderID: 42, Kind: STATUS_REFUNDED, Sequence: 1},
+		// Duplicate.
+		{OrderID: 42, Kind: STATUS_FAILED, Status: order.FAIL, Sequence: 2},
+	}
+	for _, update := range updates {
+		if err := c.HandleStatusUpdate(ctx, statusTask(t, update)); err != nil {
+			t.Fatalf("%s %d: %v", update.Kind, update.Sequence, err)
+		}
+	}
+
+	want := []order.OrderStatus{order.FAIL, REFUNDED}
+	if got := fake.Updates(42); !reflect.DeepEqual(got, want) {
+		t.Errorf("order 42: %v, want %v", got, want)
+	}
+	if got, _ := mr.Get(appliedKey(42)); got != "2" {
+		t.Errorf("applied sequence %q, want 2", got)
+	}
+	if mr.Exists(lockKey(42)) {
+		t.Error("order still locked")
+	}
+}
+
+func TestConsumerLocked(t *testing.T) {
+	c, fake, mr := newTestConsumer(t)
+	ctx := context.Background()
+
+	mr.Set(lockKey(42), "other")
+
+	update := StatusUpdate{OrderID: 42, Kind: STATUS_FAILED, Status: order.FAIL, Sequence: 1}
+	if err := c.HandleStatusUpdate(ctx, statusTask(t, update)); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Updates(42); len(got) != 0 {
+		t.Errorf("applied %v while locked", got)
+	}
+
+	// Enqueued again instead of retried.
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{Addr: mr.Addr()})
+	defer inspector.Close()
+	scheduled, err := inspector.ListScheduledTasks(DEFAULT_STATUS_QUEUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scheduled) != 1 || scheduled[0].MaxRetry != STATUS_MAX_RETRY {
+		t.Fatalf("scheduled %v, want the update", scheduled)
+	}
+	if wait := time.Until(scheduled[0].NextProcessAt); wait <= 0 || wait > STATUS_LOCK_RETRY_DELAY {
+		t.Errorf("runs again in %s, want at most %s", wait, STATUS_LOCK_RETRY_DELAY)
+	}
+
+	// Only the holder releases the lock.
+	unlockScript.Run(ctx, c.redis, []string{lockKey(42)}, "mine")
+	if got, _ := mr.Get(lockKey(42)); got != "other" {
+		t.Errorf("lock held by %q, want other", got)
+	}
+}
@@ -0,0 +1,69 @@
+package ordersvc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+)
+
+type Update struct {
+	OrderID uint
+	Status  order.OrderStatus
+}
+
+// Fake records the status updates instead of sending them, for tests and
+// local runs without an order service.
+type Fake struct {
+	mutex   sync.Mutex
+	updates []Update
+
+	// Err is returned by every update when set.
+	Err error
+}
+
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+func (f *Fake) SetFailed(ctx context.Context, orderID uint, status order.OrderStatus) error {
+	return f.record(orderID, status)
+}
+
+func (f *Fake) SetSucceeded(ctx context.Context, orderID uint) error {
+	return f.record(orderID, order.SUCCESS)
+}
+
+func (f *Fake) SetRefunded(ctx context.Context, orderID uint) error {
+	return f.record(orderID, REFUNDED)
+}
+
+func (f *Fake) Close() error {
+	return nil
+}
+
+func (f *Fake) record(orderID uint, status order.OrderStatus) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+
+	f.updates = append(f.updates, Update{OrderID: orderID, Status: status})
+	return nil
+}
+
+// Updates returns the updates of the order, oldest first.
+func (f *Fake) Updates(orderID uint) []order.OrderStatus {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var statuses []order.OrderStatus
+	for _, update := range f.updates {
+		if update.OrderID == orderID {
+			statuses = append(statuses, update.Status)
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,116 @@
+package ordersvc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/ordersvc/orderpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCClient talks to the order service through orderpb.OrderStatusService.
+type GRPCClient struct {
+	options Options
+	conn    *grpc.ClientConn
+	client  orderpb.OrderStatusServiceClient
+}
+
+func NewGRPCClient(addr string, options Options) (*GRPCClient, error) {
+	options = options.withDefaults()
+
+	conn, err := grpc.Dial(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(TracingClientInterceptor),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GRPCClient{
+		options: options,
+		conn:    conn,
+		client:  orderpb.NewOrderStatusServiceClient(conn),
+	}, nil
+}
+
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *GRPCClient) SetFailed(ctx context.Context, orderID uint, status order.OrderStatus) error {
+	return c.call(ctx, c.client.SetFailed, orderID, status)
+}
+
+func (c *GRPCClient) SetSucceeded(ctx context.Context, orderID uint) error {
+	return c.notify(ctx, c.client.SetSucceeded, orderID, order.SUCCESS)
+}
+
+func (c *GRPCClient) SetRefunded(ctx context.Context, orderID uint) error {
+	return c.notify(ctx, c.client.SetRefunded, orderID, REFUNDED)
+}
+
+// notify sends a status the order service may not implement.
+func (c *GRPCClient) notify(ctx context.Context, method setStatusFunc, orderID uint, orderStatus order.OrderStatus) error {
+	err := c.call(ctx, method, orderID, orderStatus)
+	if status.Code(err) == codes.Unimplemented {
+		log.Printf("Order service doesn't support %s updates, skipping\n", orderStatus)
+		return nil
+	}
+	return err
+}
+
+type setStatusFunc func(ctx context.Context, in *orderpb.SetStatusRequest, opts ...grpc.CallOption) (*orderpb.SetStatusResponse, error)
+
+// call sends the status with a deadline per attempt, retrying on transient codes.
+func (c *GRPCClient) call(ctx context.Context, method setStatusFunc, orderID uint, orderStatus order.OrderStatus) error {
+	req := &orderpb.SetStatusRequest{
+		OrderId:     uint64(orderID),
+		OrderStatus: string(orderStatus),
+	}
+
+	backoff := c.options.Backoff
+
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+		_, err := method(callCtx, req)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+
+		if !retryable(err) {
+			return err
+		}
+
+		if attempt >= c.options.MaxAttempts {
+			return fmt.Errorf("Failed to update order status after %d attempts: %w", attempt, err)
+		}
+
+		log.Printf("Failed to update order status (attempt %d): %v\n", attempt, err)
+
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,186 @@
+package ordersvc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/ordersvc/orderpb"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// flakyServer fails the first SetFailed calls with the codes of fail before
+// handing them to the local server.
+type flakyServer struct {
+	*Server
+
+	mutex    sync.Mutex
+	fail     []codes.Code
+	metadata []metadata.MD
+}
+
+func (s *flakyServer) SetFailed(ctx context.Context, req *orderpb.SetStatusRequest) (*orderpb.SetStatusResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	s.mutex.Lock()
+	s.metadata = append(s.metadata, md)
+	code := codes.OK
+	if len(s.fail) > 0 {
+		code, s.fail = s.fail[0], s.fail[1:]
+	}
+	s.mutex.Unlock()
+
+	if code != codes.OK {
+		return nil, status.Error(code, code.String())
+	}
+	return s.Server.SetFailed(ctx, req)
+}
+
+func (s *flakyServer) Metadata() []metadata.MD {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.metadata
+}
+
+// serve serves the implementation on a random local port and returns a client for it.
+func serve(t *testing.T, impl orderpb.OrderStatusServiceServer, maxAttempts int) *GRPCClient {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(TracingServerInterceptor))
+	orderpb.RegisterOrderStatusServiceServer(server, impl)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	c, err := NewGRPCClient(lis.Addr().String(), Options{
+		Timeout:     time.Second,
+		MaxAttempts: maxAttempts,
+		Backoff:     time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestGRPCClientUpdates(t *testing.T) {
+	fake := NewFake()
+	c := serve(t, &Server{backend: fake}, 1)
+	ctx := context.Background()
+
+	if err := c.SetFailed(ctx, 42, order.PAYMENT_FAIL_INSUFFICIENT); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetRefunded(ctx, 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetSucceeded(ctx, 43); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []order.OrderStatus{order.PAYMENT_FAIL_INSUFFICIENT, REFUNDED}
+	if got := fake.Updates(42); !reflect.DeepEqual(got, want) {
+		t.Errorf("order 42: %v, want %v", got, want)
+	}
+	if got := fake.Updates(43); !reflect.DeepEqual(got, []order.OrderStatus{order.SUCCESS}) {
+		t.Errorf("order 43: %v, want SUCCESS", got)
+	}
+}
+
+func TestGRPCClientRetries(t *testing.T) {
+	fake := NewFake()
+	s := &flakyServer{Server: &Server{backend: fake}, fail: []codes.Code{codes.Unavailable, codes.ResourceExhausted}}
+	c := serve(t, s, 3)
+
+	if err := c.SetFailed(context.Background(), 42, order.FAIL); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(s.Metadata()); n != 3 {
+		t.Errorf("sent %d requests, want 3", n)
+	}
+	if got := fake.Updates(42); !reflect.DeepEqual(got, []order.OrderStatus{order.FAIL}) {
+		t.Errorf("order 42: %v, want FAIL", got)
+	}
+}
+
+func TestGRPCClientStatusCodes(t *testing.T) {
+	tests := []struct {
+		code     codes.Code
+		requests int
+	}{
+		{codes.InvalidArgument, 1},
+		{codes.Internal, 1},
+		{codes.Unavailable, 3},
+		{codes.Aborted, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			s := &flakyServer{Server: &Server{backend: NewFake()}, fail: []codes.Code{tt.code, tt.code, tt.code}}
+			c := serve(t, s, 3)
+
+			err := c.SetFailed(context.Background(), 42, order.FAIL)
+			if status.Code(err) != tt.code {
+				t.Fatalf("got %v, want %s", err, tt.code)
+			}
+			if n := len(s.Metadata()); n != tt.requests {
+				t.Errorf("sent %d requests, want %d", n, tt.requests)
+			}
+		})
+	}
+}
+
+// An order service without SetSucceeded and SetRefunded only fails the orders.
+func TestGRPCClientUnimplemented(t *testing.T) {
+	c := serve(t, orderpb.UnimplementedOrderStatusServiceServer{}, 3)
+	ctx := context.Background()
+
+	if err := c.SetSucceeded(ctx, 42); err != nil {
+		t.Errorf("SetSucceeded: %v", err)
+	}
+	if err := c.SetRefunded(ctx, 42); err != nil {
+		t.Errorf("SetRefunded: %v", err)
+	}
+	if err := c.SetFailed(ctx, 42, order.FAIL); status.Code(err) != codes.Unimplemented {
+		t.Errorf("SetFailed: got %v, want Unimplemented", err)
+	}
+}
+
+func TestGRPCClientMetadata(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+	traceID, _ := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	spanID, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	s := &flakyServer{Server: &Server{backend: NewFake()}}
+	if err := serve(t, s, 1).SetFailed(ctx, 42, order.FAIL); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	if got := s.Metadata()[0].Get("traceparent"); len(got) != 1 || got[0] != want {
+		t.Errorf("traceparent %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package ordersvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	DEFAULT_TIMEOUT      = 5 * time.Second
+	DEFAULT_MAX_ATTEMPTS = 3
+	DEFAULT_BACKOFF      = 100 * time.Millisecond
+
+	// Error bodies are truncated to this size.
+	MAX_ERROR_BODY = 512
+)
+
+type Options struct {
+	// Timeout of a single request.
+	Timeout time.Duration
+
+	// MaxAttempts is the number of times a request is sent before giving up.
+	MaxAttempts int
+
+	// Backoff before the second attempt, doubled on every attempt after.
+	Backoff time.Duration
+
+	// Queue transport only.
+	Queue       string
+	AsynqClient *asynq.Client
+	RedisClient *redis.Client
+}
+
+// HTTPClient talks to the order service over its REST API:
+// - PUT /fail/{id}
+// - PUT /success/{id}
+// - PUT /refund/{id}
+//
+// Only /fail is served by every version of the order service, the success
+// and refund notifications are skipped by the ones without them.
+type HTTPClient struct {
+	addr    string
+	options Options
+	client  *http.Client
+}
+
+func (o Options) withDefaults() Options {
+	if o.Timeout <= 0 {
+		o.Timeout = DEFAULT_TIMEOUT
+	}
+
+	if o.MaxAttempts < 1 {
+		o.MaxAttempts = DEFAULT_MAX_ATTEMPTS
+	}
+
+	if o.Backoff <= 0 {
+		o.Backoff = DEFAULT_BACKOFF
+	}
+
+	return o
+}
+
+func NewHTTPClient(addr string, options Options) *HTTPClient {
+	options = options.withDefaults()
+
+	return &HTTPClient{
+		addr:    addr,
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout},
+	}
+}
+
+func (c *HTTPClient) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func (c *HTTPClient) SetFailed(ctx context.Context, orderID uint, status order.OrderStatus) error {
+	return c.put(ctx, fmt.Sprintf("/fail/%d", orderID), status)
+}
+
+func (c *HTTPClient) SetSucceeded(ctx context.Context, orderID uint) error {
+	return c.notify(ctx, fmt.Sprintf("/success/%d", orderID), order.SUCCESS)
+}
+
+func (c *HTTPClient) SetRefunded(ctx context.Context, orderID uint) error {
+	return c.notify(ctx, fmt.Sprintf("/refund/%d", orderID), REFUNDED)
+}
+
+// notify sends a status the order service may not know about.
+func (c *HTTPClient) notify(ctx context.Context, path string, status order.OrderStatus) error {
+	err := c.put(ctx, path, status)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Unsupported() {
+		log.Printf("Order service doesn't support PUT %s, skipping\n", path)
+		return nil
+	}
+
+	return err
+}
+
+// put sends the status, retrying on network errors and retryable status codes.
+func (c *HTTPClient) put(ctx context.Context, path string, status order.OrderStatus) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"order_status": status,
+	})
+	if err != nil {
+		return err
+	}
+
+	backoff := c.options.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err = c.send(ctx, path, payload)
+		if err == nil {
+			return nil
+		}
+
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && !statusErr.Retryable() {
+			return err
+		}
+
+		if attempt >= c.options.MaxAttempts {
+			return fmt.Errorf("Failed to update order status after %d attempts: %w", attempt, err)
+		}
+
+		log.Printf("Failed to update order status (attempt %d): %v\n", attempt, err)
+
+		// Jitter, so the steps don't retry in lockstep.
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *HTTPClient) send(ctx context.Context, path string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("http://%s%s", c.addr, path), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Continue the trace of the saga on the order service.
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, MAX_ERROR_BODY))
+	return &StatusError{Code: resp.StatusCode, Body: string(body)}
+}
@@ -0,0 +1,260 @@
+package ordersvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// orderService is a local order service recording the updates to a Fake. The
+// first requests are answered with the codes of fail, if any.
+type orderService struct {
+	*httptest.Server
+
+	fake *Fake
+
+	mutex    sync.Mutex
+	fail     []int
+	requests []*http.Request
+	// Paths answered with 404, like an order service without them.
+	missing []string
+}
+
+func newOrderService(t *testing.T, fail ...int) *orderService {
+	s := &orderService{fake: NewFake(), fail: fail}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *orderService) serve(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests = append(s.requests, r)
+	var code int
+	if len(s.fail) > 0 {
+		code, s.fail = s.fail[0], s.fail[1:]
+	}
+	missing := s.missing
+	s.mutex.Unlock()
+
+	if code != 0 {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if r.Method != http.MethodPut || len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	for _, path := range missing {
+		if parts[0] == path {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	orderID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		OrderStatus order.OrderStatus `json:"order_status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch parts[0] {
+	case "fail":
+		err = s.fake.SetFailed(r.Context(), uint(orderID), body.OrderStatus)
+	case "success":
+		err = s.fake.SetSucceeded(r.Context(), uint(orderID))
+	case "refund":
+		err = s.fake.SetRefunded(r.Context(), uint(orderID))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *orderService) Requests() []*http.Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests
+}
+
+func (s *orderService) client(maxAttempts int) *HTTPClient {
+	return NewHTTPClient(strings.TrimPrefix(s.URL, "http://"), Options{
+		Timeout:     time.Second,
+		MaxAttempts: maxAttempts,
+		Backoff:     time.Millisecond,
+	})
+}
+
+func TestHTTPClientUpdates(t *testing.T) {
+	s := newOrderService(t)
+	c := s.client(1)
+	ctx := context.Background()
+
+	if err := c.SetFailed(ctx, 42, order.PAYMENT_FAIL_INSUFFICIENT); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetRefunded(ctx, 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetSucceeded(ctx, 43); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []order.OrderStatus{order.PAYMENT_FAIL_INSUFFICIENT, REFUNDED}
+	if got := s.fake.Updates(42); !reflect.DeepEqual(got, want) {
+		t.Errorf("order 42: %v, want %v", got, want)
+	}
+	if got := s.fake.Updates(43); !reflect.DeepEqual(got, []order.OrderStatus{order.SUCCESS}) {
+		t.Errorf("order 43: %v, want SUCCESS", got)
+	}
+}
+
+func TestHTTPClientRetries(t *testing.T) {
+	s := newOrderService(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+	if err := s.client(3).SetFailed(context.Background(), 42, order.FAIL); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(s.Requests()); n != 3 {
+		t.Errorf("sent %d requests, want 3", n)
+	}
+	if got := s.fake.Updates(42); !reflect.DeepEqual(got, []order.OrderStatus{order.FAIL}) {
+		t.Errorf("order 42: %v, want FAIL", got)
+	}
+}
+
+func TestHTTPClientGivesUp(t *testing.T) {
+	s := newOrderService(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+
+	err := s.client(2).SetFailed(context.Background(), 42, order.FAIL)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusBadGateway {
+		t.Fatalf("got %v, want a 502", err)
+	}
+	if n := len(s.Requests()); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+}
+
+func TestHTTPClientStatusCodes(t *testing.T) {
+	tests := []struct {
+		code     int
+		requests int
+	}{
+		{http.StatusBadRequest, 1},
+		{http.StatusConflict, 1},
+		{http.StatusNotImplemented, 1},
+		{http.StatusInternalServerError, 3},
+		{http.StatusServiceUnavailable, 3},
+		{http.StatusTooManyRequests, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.code), func(t *testing.T) {
+			s := newOrderService(t, tt.code, tt.code, tt.code)
+
+			err := s.client(3).SetFailed(context.Background(), 42, order.FAIL)
+
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.Code != tt.code {
+				t.Fatalf("got %v, want a %d", err, tt.code)
+			}
+			if n := len(s.Requests()); n != tt.requests {
+				t.Errorf("sent %d requests, want %d", n, tt.requests)
+			}
+		})
+	}
+}
+
+// An order service without /success and /refund only fails the orders.
+func TestHTTPClientUnsupported(t *testing.T) {
+	s := newOrderService(t)
+	s.missing = []string{"success", "refund", "fail"}
+	c := s.client(3)
+	ctx := context.Background()
+
+	if err := c.SetSucceeded(ctx, 42); err != nil {
+		t.Errorf("SetSucceeded: %v", err)
+	}
+	if err := c.SetRefunded(ctx, 42); err != nil {
+		t.Errorf("SetRefunded: %v", err)
+	}
+	if err := c.SetFailed(ctx, 42, order.FAIL); err == nil {
+		t.Error("SetFailed succeeded without /fail")
+	}
+
+	if n := len(s.Requests()); n != 3 {
+		t.Errorf("sent %d requests, want 3", n)
+	}
+}
+
+func TestHTTPClientHeaders(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+	traceID, _ := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	spanID, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	s := newOrderService(t)
+	if err := s.client(1).SetFailed(ctx, 42, order.FAIL); err != nil {
+		t.Fatal(err)
+	}
+
+	r := s.Requests()[0]
+	if got := r.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type %q, want application/json", got)
+	}
+
+	want := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	if got := r.Header.Get("traceparent"); got != want {
+		t.Errorf("traceparent %q, want %q", got, want)
+	}
+}
+
+func TestFakeErr(t *testing.T) {
+	fake := NewFake()
+	fake.Err = errors.New("down")
+
+	if err := fake.SetSucceeded(context.Background(), 42); err != fake.Err {
+		t.Errorf("got %v, want %v", err, fake.Err)
+	}
+	if got := fake.Updates(42); len(got) != 0 {
+		t.Errorf("recorded %v while failing", got)
+	}
+}
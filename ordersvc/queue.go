@@ -0,0 +1,114 @@
+package ordersvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	TRANSPORT_QUEUE = "queue"
+
+	DEFAULT_STATUS_QUEUE = "order_status"
+
+	// Retries of an update before asynq archives it.
+	STATUS_MAX_RETRY = 25
+
+	// Sequences of an order expire once its sagas are long over.
+	STATUS_SEQUENCE_TTL = 24 * time.Hour
+)
+
+const (
+	STATUS_FAILED    = "failed"
+	STATUS_SUCCEEDED = "succeeded"
+	STATUS_REFUNDED  = "refunded"
+)
+
+// StatusUpdate is the payload of an "order:status" task.
+type StatusUpdate struct {
+	OrderID uint              `json:"order_id"`
+	Kind    string            `json:"kind"` // STATUS_FAILED, STATUS_SUCCEEDED or STATUS_REFUNDED.
+	Status  order.OrderStatus `json:"order_status"`
+
+	// Sequence orders the updates of the same order, it only ever grows.
+	Sequence int64     `json:"sequence"`
+	SentAt   time.Time `json:"sent_at"`
+
+	TraceCarrier propagation.MapCarrier `json:"trace_carrier,omitempty"`
+}
+
+// QueueClient publishes the status updates to a dedicated asynq queue instead
+// of calling the order service, which consumes them at its own pace.
+type QueueClient struct {
+	queue  string
+	client *asynq.Client
+	redis  *redis.Client
+}
+
+func NewQueueClient(queue string, client *asynq.Client, redisClient *redis.Client) *QueueClient {
+	if len(queue) == 0 {
+		queue = DEFAULT_STATUS_QUEUE
+	}
+
+	return &QueueClient{
+		queue:  queue,
+		client: client,
+		redis:  redisClient,
+	}
+}
+
+// Close leaves the asynq and redis clients open, they are shared with the app.
+func (c *QueueClient) Close() error {
+	return nil
+}
+
+func (c *QueueClient) SetFailed(ctx context.Context, orderID uint, status order.OrderStatus) error {
+	return c.publish(ctx, orderID, STATUS_FAILED, status)
+}
+
+func (c *QueueClient) SetSucceeded(ctx context.Context, orderID uint) error {
+	return c.publish(ctx, orderID, STATUS_SUCCEEDED, order.SUCCESS)
+}
+
+func (c *QueueClient) SetRefunded(ctx context.Context, orderID uint) error {
+	return c.publish(ctx, orderID, STATUS_REFUNDED, REFUNDED)
+}
+
+func sequenceKey(orderID uint) string {
+	return fmt.Sprintf("order:status:seq:%d", orderID)
+}
+
+func (c *QueueClient) publish(ctx context.Context, orderID uint, kind string, status order.OrderStatus) error {
+	// NOTE(Appy): Every step shares the counter, so the order holds across services.
+	sequence, err := c.redis.Incr(ctx, sequenceKey(orderID)).Result()
+	if err != nil {
+		return fmt.Errorf("Failed to sequence order status: %w", err)
+	}
+	c.redis.Expire(ctx, sequenceKey(orderID), STATUS_SEQUENCE_TTL)
+
+	update := StatusUpdate{
+		OrderID:      orderID,
+		Kind:         kind,
+		Status:       status,
+		Sequence:     sequence,
+		SentAt:       time.Now(),
+		TraceCarrier: make(propagation.MapCarrier),
+	}
+	otel.GetTextMapPropagator().Inject(ctx, update.TraceCarrier)
+
+	payload, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask("order:status", payload)
+	_, err = c.client.EnqueueContext(ctx, task, asynq.Queue(c.queue), asynq.MaxRetry(STATUS_MAX_RETRY))
+	return err
+}
@@ -0,0 +1,70 @@
+package ordersvc
+
+import (
+	"context"
+	"log"
+	"net"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/ordersvc/orderpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements orderpb.OrderStatusService on top of an OrderClient. With
+// a Fake it is a local stand-in for the order service.
+type Server struct {
+	orderpb.UnimplementedOrderStatusServiceServer
+
+	backend OrderClient
+}
+
+func NewServer(backend OrderClient) *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(TracingServerInterceptor))
+	orderpb.RegisterOrderStatusServiceServer(server, &Server{backend: backend})
+	return server
+}
+
+// ServeLocal serves the status updates on the address until the listener fails.
+func ServeLocal(addr string, backend OrderClient) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Order status server listening on", lis.Addr())
+	return NewServer(backend).Serve(lis)
+}
+
+func (s *Server) SetFailed(ctx context.Context, req *orderpb.SetStatusRequest) (*orderpb.SetStatusResponse, error) {
+	if len(req.GetOrderStatus()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing order status")
+	}
+
+	orderStatus := order.OrderStatus(req.GetOrderStatus())
+	log.Printf("Order %d: %s\n", req.GetOrderId(), orderStatus)
+	if err := s.backend.SetFailed(ctx, uint(req.GetOrderId()), orderStatus); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &orderpb.SetStatusResponse{OrderStatus: string(orderStatus)}, nil
+}
+
+func (s *Server) SetSucceeded(ctx context.Context, req *orderpb.SetStatusRequest) (*orderpb.SetStatusResponse, error) {
+	log.Printf("Order %d: %s\n", req.GetOrderId(), order.SUCCESS)
+	if err := s.backend.SetSucceeded(ctx, uint(req.GetOrderId())); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &orderpb.SetStatusResponse{OrderStatus: string(order.SUCCESS)}, nil
+}
+
+func (s *Server) SetRefunded(ctx context.Context, req *orderpb.SetStatusRequest) (*orderpb.SetStatusResponse, error) {
+	log.Printf("Order %d: %s\n", req.GetOrderId(), REFUNDED)
+	if err := s.backend.SetRefunded(ctx, uint(req.GetOrderId())); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &orderpb.SetStatusResponse{OrderStatus: string(REFUNDED)}, nil
+}
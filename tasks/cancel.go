@@ -0,0 +1,86 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+)
+
+//----------------------------------------------
+// Order cancellation.
+//---------------------------------------------
+
+const (
+	CANCEL_KEY_PREFIX = "saga:cancelled"
+
+	// Long enough to outlive every saga of the order.
+	CANCEL_FLAG_TTL = 24 * time.Hour
+)
+
+var ErrOrderCancelled = NewBusinessError(errors.New("Order cancelled"))
+
+// CancelPayload is the payload of a "task:cancel", sent by the order service.
+type CancelPayload struct {
+	OrderID uint   `json:"order_id"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func NewCancelTask(orderID uint, reason string) (*asynq.Task, error) {
+	payload, err := json.Marshal(CancelPayload{OrderID: orderID, Reason: reason})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask("task:cancel", payload), nil
+}
+
+func cancelKey(orderID uint) string {
+	return fmt.Sprintf("%s:%d", CANCEL_KEY_PREFIX, orderID)
+}
+
+// CancelOrder flags the order as cancelled. The flag is shared by every step,
+// each of them checks it before committing and after its handoff.
+func CancelOrder(ctx context.Context, client *redis.Client, orderID uint, reason string) error {
+	return client.Set(ctx, cancelKey(orderID), reason, CANCEL_FLAG_TTL).Err()
+}
+
+// IsCancelled reports whether the order was cancelled. Cancellation is best
+// effort, the saga carries on if Redis can't be reached.
+func (t TaskContext) IsCancelled(orderID uint) bool {
+	if t.RedisClient == nil {
+		return false
+	}
+
+	n, err := t.RedisClient.Exists(context.Background(), cancelKey(orderID)).Result()
+	if err != nil {
+		log.Println("Failed to check cancellation:", err)
+		return false
+	}
+
+	return n > 0
+}
+
+func HandleCancelTask(ctx context.Context, t *asynq.Task) error {
+	taskContext := GetTaskContext(ctx)
+
+	var p CancelPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	if taskContext.RedisClient == nil {
+		return fmt.Errorf("No redis client: %w", asynq.SkipRetry)
+	}
+
+	if err := CancelOrder(ctx, taskContext.RedisClient, p.OrderID, p.Reason); err != nil {
+		return err
+	}
+
+	log.Printf("Order %d cancelled: %s\n", p.OrderID, p.Reason)
+	return nil
+}
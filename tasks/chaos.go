@@ -0,0 +1,134 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+//----------------------------------------------
+// Chaos injection.
+//---------------------------------------------
+
+const (
+	// Every step the chaos spec targets.
+	CHAOS_TARGET_ALL = "*"
+
+	// A dropped handoff is parked for longer than any handoff timeout.
+	CHAOS_DROP_DELAY = time.Hour
+)
+
+// ChaosSpec describes the faults injected into a step. It is either carried in
+// the payload, targeting a step by its server queue, or set on the service
+// through CHAOS_SPEC. The payload takes precedence.
+type ChaosSpec struct {
+	Target string `json:"target,omitempty"` // Server queue of the step, "*" for every step.
+
+	LatencyMs       int64   `json:"latency_ms,omitempty"`        // Injected before the step runs.
+	FailureRate     float64 `json:"failure_rate,omitempty"`      // Probability of failing the perform, 0 to 1.
+	FailAfterCommit bool    `json:"fail_after_commit,omitempty"` // Fail the perform once the charge is committed.
+	FailRevert      bool    `json:"fail_revert,omitempty"`       // Fail the revert before the refund is committed.
+	DropHandoff     bool    `json:"drop_handoff,omitempty"`      // The next step never picks up the task.
+
+	// Same seed, same saga, same faults.
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// Chaos is the spec resolved for the running step.
+type Chaos struct {
+	ChaosSpec
+	random *rand.Rand
+}
+
+// NewChaos resolves the spec of the step. Returns nil if no fault is injected.
+// The random source only depends on the seed, the saga and the step, so a run
+// can be reproduced.
+func NewChaos(p StepPayload, ctx *TaskContext) *Chaos {
+	var spec *ChaosSpec
+	for i := range p.Chaos {
+		if p.Chaos[i].Target == ctx.ServerQueue || p.Chaos[i].Target == CHAOS_TARGET_ALL {
+			spec = &p.Chaos[i]
+			break
+		}
+	}
+
+	if spec == nil {
+		spec = ctx.ChaosSpec
+	}
+
+	if spec == nil {
+		return nil
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%s|%s|%d", p.SagaKey(), ctx.ServerQueue, ctx.Job, p.Attempt)
+
+	return &Chaos{
+		ChaosSpec: *spec,
+		random:    rand.New(rand.NewSource(spec.Seed ^ int64(h.Sum64()))),
+	}
+}
+
+// Delay sleeps for the injected latency, or until the context is done.
+func (c *Chaos) Delay(ctx context.Context, taskCtx *TaskContext) error {
+	if c == nil || c.LatencyMs <= 0 {
+		return nil
+	}
+
+	latency := time.Duration(c.LatencyMs) * time.Millisecond
+	taskCtx.Span.AddEvent(fmt.Sprintf("Chaos: injecting %s of latency", latency))
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(latency):
+		return nil
+	}
+}
+
+func (c *Chaos) ShouldFail() bool {
+	return c != nil && c.FailureRate > 0 && c.random.Float64() < c.FailureRate
+}
+
+func (c *Chaos) ShouldFailAfterCommit() bool {
+	return c != nil && c.FailAfterCommit
+}
+
+func (c *Chaos) ShouldFailRevert() bool {
+	return c != nil && c.FailRevert
+}
+
+func (c *Chaos) ShouldDropHandoff() bool {
+	return c != nil && c.DropHandoff
+}
+
+// HandoffOptions park a dropped handoff, so the handoff times out like it
+// would if no server took the task.
+func (c *Chaos) HandoffOptions(taskCtx *TaskContext) []asynq.Option {
+	if !c.ShouldDropHandoff() {
+		return nil
+	}
+
+	taskCtx.Span.AddEvent(fmt.Sprintf("Chaos: dropping the handoff to %s", taskCtx.NextQueue))
+	return []asynq.Option{asynq.ProcessIn(CHAOS_DROP_DELAY)}
+}
+
+// LoadChaosSpec parses the CHAOS_SPEC of the service.
+func LoadChaosSpec(data string) (*ChaosSpec, error) {
+	spec := &ChaosSpec{}
+	if err := json.Unmarshal([]byte(data), spec); err != nil {
+		return nil, err
+	}
+
+	if len(spec.Target) > 0 {
+		log.Println("Target is ignored in CHAOS_SPEC, it applies to this service")
+	}
+
+	return spec, nil
+}
@@ -0,0 +1,62 @@
+package tasks
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrOrderReverted = NewBusinessError(errors.New("Order already reverted"))
+
+// Charge records that an order was charged, and then refunded. There is at
+// most one per order: the unique index serialises a perform and a revert of
+// the same order, so a retried revert never refunds twice, and a revert never
+// refunds an order that wasn't charged.
+type Charge struct {
+	gorm.Model
+
+	OrderID  uint `json:"order_id" gorm:"uniqueIndex"`
+	Refunded bool `json:"refunded"`
+}
+
+// RecordCharge must be called inside the charge transaction. Returns false if
+// the order was already charged, and ErrOrderReverted if it was reverted
+// before it could be charged.
+func RecordCharge(tsx *gorm.DB, orderID uint) (bool, error) {
+	result := tsx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Charge{OrderID: orderID})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return true, nil
+	}
+
+	charge := &Charge{}
+	if err := tsx.Where(&Charge{OrderID: orderID}).First(charge).Error; err != nil {
+		return false, err
+	}
+	if charge.Refunded {
+		return false, ErrOrderReverted
+	}
+	return false, nil
+}
+
+// RecordRefund must be called inside the refund transaction. Returns false if
+// the order was already refunded, or was never charged.
+func RecordRefund(tsx *gorm.DB, orderID uint) (bool, error) {
+	// NOTE(Appy): Not charged yet, leave a refunded record so a perform that
+	// is still running can't charge it anymore.
+	result := tsx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Charge{OrderID: orderID, Refunded: true})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return false, nil
+	}
+
+	result = tsx.Model(&Charge{}).
+		Where("order_id = ? AND refunded = ?", orderID, false).
+		Update("refunded", true)
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,231 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/alex-appy-love-story/worker-template/tasks/sagapb"
+	"google.golang.org/protobuf/proto"
+)
+
+//----------------------------------------------
+// Payload encodings.
+//---------------------------------------------
+
+const (
+	CONTENT_TYPE_JSON     = "application/json"
+	CONTENT_TYPE_PROTOBUF = "application/protobuf"
+)
+
+// Marshal encodes the envelope as json, so the decoder can read its content
+// type first. The body must already be encoded with the content type, it is
+// carried as is if json, or as base64.
+func (e Envelope) Marshal() ([]byte, error) {
+	if e.Version == SCHEMA_V0 {
+		return marshalV0(e)
+	}
+
+	if e.ContentType == CONTENT_TYPE_PROTOBUF {
+		body, err := json.Marshal([]byte(e.Body))
+		if err != nil {
+			return nil, err
+		}
+		e.Body = body
+	}
+
+	return json.Marshal(e)
+}
+
+// marshalV0 writes the flat json map of v0, the saga ID and the step are
+// added next to the fields of the body.
+func marshalV0(e Envelope) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(e.Body, &fields); err != nil {
+		return nil, err
+	}
+
+	if len(e.SagaID) > 0 {
+		fields["saga_id"], _ = json.Marshal(e.SagaID)
+	}
+	if len(e.Step) > 0 {
+		fields["step"], _ = json.Marshal(e.Step)
+	}
+
+	return json.Marshal(fields)
+}
+
+// unwrapBody returns the encoded body carried by the envelope.
+func unwrapBody(contentType string, body json.RawMessage) (json.RawMessage, error) {
+	if contentType != CONTENT_TYPE_PROTOBUF {
+		return body, nil
+	}
+
+	var b []byte
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func encodeBody(contentType string, body interface{}) ([]byte, error) {
+	if contentType != CONTENT_TYPE_PROTOBUF {
+		return json.Marshal(body)
+	}
+
+	// Same body, same bytes: the trace carrier is a map.
+	marshal := proto.MarshalOptions{Deterministic: true}
+
+	switch b := body.(type) {
+	case OrderMessage:
+		return marshal.Marshal(orderMessageToProto(b))
+	case StepReply:
+		return marshal.Marshal(stepReplyToProto(b))
+	default:
+		return nil, fmt.Errorf("No protobuf encoding for %T", body)
+	}
+}
+
+func decodeProtoBody(data []byte, v interface{}) error {
+	switch t := v.(type) {
+	case *OrderMessage:
+		var m sagapb.OrderMessage
+		if err := proto.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		*t = orderMessageFromProto(&m)
+	case *StepPayload:
+		var m sagapb.OrderMessage
+		if err := proto.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		msg := orderMessageFromProto(&m)
+		t.SagaPayload = msg.SagaPayload
+		t.OrderID = msg.OrderID
+		t.Username = msg.Username
+		t.TokenID = msg.TokenID
+		t.Amount = msg.Amount
+	case *StepReply:
+		var m sagapb.StepReply
+		if err := proto.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		*t = stepReplyFromProto(&m)
+	default:
+		return fmt.Errorf("No protobuf decoding for %T", v)
+	}
+
+	return nil
+}
+
+func sagaPayloadToProto(p SagaPayload) *sagapb.SagaPayload {
+	return &sagapb.SagaPayload{
+		FailTrigger:  p.FailTrigger,
+		Chaos:        chaosSpecsToProto(p.Chaos),
+		ReplyQueue:   p.ReplyQueue,
+		Attempt:      int64(p.Attempt),
+		Deadline:     p.Deadline,
+		RevertedBy:   p.RevertedBy,
+		Branches:     p.Branches,
+		SkipPrevious: p.SkipPrevious,
+		TraceCarrier: p.TraceCarrier,
+	}
+}
+
+func sagaPayloadFromProto(m *sagapb.SagaPayload) SagaPayload {
+	return SagaPayload{
+		FailTrigger:  m.GetFailTrigger(),
+		Chaos:        chaosSpecsFromProto(m.GetChaos()),
+		ReplyQueue:   m.GetReplyQueue(),
+		Attempt:      int(m.GetAttempt()),
+		Deadline:     m.GetDeadline(),
+		RevertedBy:   m.GetRevertedBy(),
+		Branches:     m.GetBranches(),
+		SkipPrevious: m.GetSkipPrevious(),
+		TraceCarrier: m.GetTraceCarrier(),
+	}
+}
+
+func chaosSpecsToProto(specs []ChaosSpec) []*sagapb.ChaosSpec {
+	var m []*sagapb.ChaosSpec
+	for _, spec := range specs {
+		m = append(m, &sagapb.ChaosSpec{
+			Target:          spec.Target,
+			LatencyMs:       spec.LatencyMs,
+			FailureRate:     spec.FailureRate,
+			FailAfterCommit: spec.FailAfterCommit,
+			FailRevert:      spec.FailRevert,
+			DropHandoff:     spec.DropHandoff,
+			Seed:            spec.Seed,
+		})
+	}
+	return m
+}
+
+func chaosSpecsFromProto(m []*sagapb.ChaosSpec) []ChaosSpec {
+	var specs []ChaosSpec
+	for _, spec := range m {
+		specs = append(specs, ChaosSpec{
+			Target:          spec.GetTarget(),
+			LatencyMs:       spec.GetLatencyMs(),
+			FailureRate:     spec.GetFailureRate(),
+			FailAfterCommit: spec.GetFailAfterCommit(),
+			FailRevert:      spec.GetFailRevert(),
+			DropHandoff:     spec.GetDropHandoff(),
+			Seed:            spec.GetSeed(),
+		})
+	}
+	return specs
+}
+
+func orderMessageToProto(m OrderMessage) *sagapb.OrderMessage {
+	return &sagapb.OrderMessage{
+		Saga:     sagaPayloadToProto(m.SagaPayload),
+		OrderId:  uint64(m.OrderID),
+		Username: m.Username,
+		TokenId:  uint64(m.TokenID),
+		Amount:   uint64(m.Amount),
+	}
+}
+
+func orderMessageFromProto(m *sagapb.OrderMessage) OrderMessage {
+	return OrderMessage{
+		SagaPayload: sagaPayloadFromProto(m.GetSaga()),
+		OrderID:     uint(m.GetOrderId()),
+		Username:    m.GetUsername(),
+		TokenID:     uint(m.GetTokenId()),
+		Amount:      uint(m.GetAmount()),
+	}
+}
+
+func stepReplyToProto(r StepReply) *sagapb.StepReply {
+	m := &sagapb.StepReply{
+		Action:       r.Action,
+		Attempt:      int64(r.Attempt),
+		Success:      r.Success,
+		Error:        r.Error,
+		TraceCarrier: r.TraceCarrier,
+	}
+
+	if r.Payload != nil {
+		m.Payload = orderMessageToProto(*r.Payload)
+	}
+
+	return m
+}
+
+func stepReplyFromProto(m *sagapb.StepReply) StepReply {
+	r := StepReply{
+		Action:       m.GetAction(),
+		Attempt:      int(m.GetAttempt()),
+		Success:      m.GetSuccess(),
+		Error:        m.GetError(),
+		TraceCarrier: m.GetTraceCarrier(),
+	}
+
+	if m.Payload != nil {
+		payload := orderMessageFromProto(m.Payload)
+		r.Payload = &payload
+	}
+
+	return r
+}
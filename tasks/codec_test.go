@@ -0,0 +1,123 @@
+package tasks
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProtobufGolden(t *testing.T) {
+	payload := marshal(t, SCHEMA_V1, CONTENT_TYPE_PROTOBUF, "saga-4242", orchestratedMessage())
+	golden(t, "orchestrated.v1.protobuf", payload)
+
+	p, err := DecodeStepPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := orchestratedMessage()
+	want.SagaID = "saga-4242"
+	if got := decoded(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestProtobufStepReply(t *testing.T) {
+	payload := marshal(t, SCHEMA_V1, CONTENT_TYPE_PROTOBUF, "saga-4242", stepReply())
+
+	r, err := DecodeStepReply(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := stepReply()
+	want.SagaID = "saga-4242"
+	want.Step = "payment"
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("decoded %+v, want %+v", r, want)
+	}
+}
+
+// The content type of the envelope picks the decoding of the body.
+func TestContentTypeNegotiation(t *testing.T) {
+	for _, contentType := range []string{CONTENT_TYPE_JSON, CONTENT_TYPE_PROTOBUF} {
+		payload := marshal(t, SCHEMA_V1, contentType, "", performMessage())
+
+		var wire struct {
+			ContentType string `json:"content_type"`
+		}
+		if err := json.Unmarshal(payload, &wire); err != nil {
+			t.Fatalf("%s: envelope isn't json: %s", contentType, err)
+		}
+		if wire.ContentType != contentType {
+			t.Errorf("envelope content type %q, want %q", wire.ContentType, contentType)
+		}
+
+		env, err := DecodeEnvelope(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.ContentType != contentType {
+			t.Errorf("decoded content type %q, want %q", env.ContentType, contentType)
+		}
+	}
+
+	// An envelope without a content type predates protobuf.
+	env, err := DecodeEnvelope([]byte(`{"version":1,"step":"payment","body":{"order_id":4242}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ContentType != CONTENT_TYPE_JSON {
+		t.Errorf("decoded content type %q, want json", env.ContentType)
+	}
+
+	if _, err := DecodeEnvelope([]byte(`{"version":1,"content_type":"application/protobuf","step":"payment","body":{"order_id":4242}}`)); err == nil {
+		t.Error("decoded a json body as protobuf")
+	}
+}
+
+// The benchmarks compare the encodings on a typical "task:perform", and report
+// the size of the payload:
+//
+//	go test ./tasks -run '^$' -bench . -benchmem
+func benchmarkEncode(b *testing.B, contentType string) {
+	body := orchestratedMessage()
+
+	var payload []byte
+	for i := 0; i < b.N; i++ {
+		env, err := NewEnvelope(SCHEMA_VERSION, contentType, "saga-4242", "payment", body)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if payload, err = env.Marshal(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(len(payload)), "payload-bytes")
+}
+
+func benchmarkDecode(b *testing.B, contentType string) {
+	env, err := NewEnvelope(SCHEMA_VERSION, contentType, "saga-4242", "payment", orchestratedMessage())
+	if err != nil {
+		b.Fatal(err)
+	}
+	payload, err := env.Marshal()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeStepPayload(payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(len(payload)), "payload-bytes")
+}
+
+func BenchmarkEncodeJSON(b *testing.B)     { benchmarkEncode(b, CONTENT_TYPE_JSON) }
+func BenchmarkEncodeProtobuf(b *testing.B) { benchmarkEncode(b, CONTENT_TYPE_PROTOBUF) }
+func BenchmarkDecodeJSON(b *testing.B)     { benchmarkDecode(b, CONTENT_TYPE_JSON) }
+func BenchmarkDecodeProtobuf(b *testing.B) { benchmarkDecode(b, CONTENT_TYPE_PROTOBUF) }
@@ -0,0 +1,87 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+//----------------------------------------------
+// Reliable compensation.
+//---------------------------------------------
+
+const (
+	// Retries of a "task:revert" before it is dead-lettered.
+	COMPENSATION_MAX_RETRY  = 10
+	COMPENSATION_BASE_DELAY = time.Second
+	COMPENSATION_MAX_DELAY  = 5 * time.Minute
+
+	// Attempts at enqueuing a compensation before giving up.
+	ENQUEUE_ATTEMPTS = 3
+	ENQUEUE_BACKOFF  = 100 * time.Millisecond
+)
+
+func CompensationOptions(queue string) []asynq.Option {
+	return []asynq.Option{
+		asynq.Queue(queue),
+		asynq.MaxRetry(COMPENSATION_MAX_RETRY),
+	}
+}
+
+// EnqueueCompensation enqueues a revert, retrying on transient Redis errors
+// until the task is cancelled. The same revert enqueued twice by different
+// steps has the same task ID, it is only processed once.
+func EnqueueCompensation(task *asynq.Task, queue string, taskID string, ctx *TaskContext) error {
+	var err error
+	backoff := ENQUEUE_BACKOFF
+
+	opts := append(CompensationOptions(queue), asynq.TaskID(taskID))
+
+	for attempt := 1; attempt <= ENQUEUE_ATTEMPTS; attempt++ {
+		_, err = ctx.AsynqClient.Enqueue(task, opts...)
+		if err == nil {
+			return nil
+		}
+
+		if IsDuplicate(err) {
+			log.Println("Compensation already enqueued:", taskID)
+			return nil
+		}
+
+		log.Printf("Failed to enqueue compensation to %s (attempt %d): %v\n", queue, attempt, err)
+		if attempt == ENQUEUE_ATTEMPTS {
+			break
+		}
+
+		select {
+		case <-ctx.Ctx.Done():
+			ctx.Span.AddEvent(fmt.Sprintf("Compensation lost: cancelled while enqueuing to %s", queue))
+			return fmt.Errorf("Failed to enqueue compensation to %s: %w", queue, errors.Join(err, ctx.Ctx.Err()))
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+
+	ctx.Span.AddEvent(fmt.Sprintf("Compensation lost: failed to enqueue to %s", queue))
+	return fmt.Errorf("Failed to enqueue compensation to %s: %w", queue, err)
+}
+
+// RetryDelay backs off exponentially with jitter for compensations, every
+// other task keeps the asynq default.
+func RetryDelay(n int, err error, t *asynq.Task) time.Duration {
+	if t.Type() != "task:revert" {
+		return asynq.DefaultRetryDelayFunc(n, err, t)
+	}
+
+	delay := COMPENSATION_BASE_DELAY << uint(n)
+	if delay <= 0 || delay > COMPENSATION_MAX_DELAY {
+		delay = COMPENSATION_MAX_DELAY
+	}
+
+	// Full jitter, so retries of many sagas don't hit the dependency at once.
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
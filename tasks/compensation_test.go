@@ -0,0 +1,39 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hibiken/asynq"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redis is down and the task is cancelled, the retries stop right away.
+func TestEnqueueCompensationCancelled(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := asynq.NewClient(asynq.RedisClientOpt{Addr: mr.Addr()})
+	defer client.Close()
+	mr.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	taskContext := &TaskContext{
+		Ctx:         ctx,
+		AsynqClient: client,
+		Span:        trace.SpanFromContext(ctx),
+	}
+
+	start := time.Now()
+	err := EnqueueCompensation(asynq.NewTask("task:revert", nil), "inventory", "saga-42:inventory:revert", taskContext)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want a cancellation", err)
+	}
+	// Backing off would take 3 times ENQUEUE_BACKOFF.
+	if elapsed := time.Since(start); elapsed >= 3*ENQUEUE_BACKOFF {
+		t.Errorf("gave up after %s, want no back-off", elapsed)
+	}
+}
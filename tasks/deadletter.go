@@ -0,0 +1,178 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//----------------------------------------------
+// Dead letters.
+//---------------------------------------------
+
+// DeadLetter is a compensation that exhausted its retries. It waits in the
+// dead-letter queue, which no server consumes, until an operator replays it.
+type DeadLetter struct {
+	Type     string    `json:"type"`
+	Queue    string    `json:"queue"`   // Queue the task is replayed on.
+	TaskID   string    `json:"task_id"` // ID of the original, archived by asynq.
+	Payload  []byte    `json:"payload"`
+	Error    string    `json:"error"`
+	Retried  int       `json:"retried"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type DeadLetterInfo struct {
+	ID string
+	DeadLetter
+}
+
+// HandleTaskError satisfies asynq.ErrorHandlerFunc.
+func HandleTaskError(ctx context.Context, t *asynq.Task, err error) {
+	DeadLetterHandler(ctx, t, err)
+	SagaExpiredHandler(ctx, t, err)
+}
+
+// DeadLetterHandler satisfies asynq.ErrorHandlerFunc. Compensations which
+// exhausted their retries are copied to the dead-letter queue and an alert is
+// added to the trace of the saga.
+func DeadLetterHandler(ctx context.Context, t *asynq.Task, err error) {
+	if t.Type() != "task:revert" {
+		return
+	}
+
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	if retried < maxRetry && !errors.Is(err, asynq.SkipRetry) {
+		return
+	}
+
+	taskContext := GetTaskContext(ctx)
+	queue, _ := asynq.GetQueueName(ctx)
+	taskID, _ := asynq.GetTaskID(ctx)
+
+	if len(taskContext.DeadLetterQueue) == 0 {
+		log.Println("No dead-letter queue, compensation lost:", taskID)
+		return
+	}
+
+	// Alert on the trace of the saga.
+	p, _ := DecodeStepPayload(t.Payload())
+	fetchSpan(&p, context.Background(), taskContext, "dead_letter")
+	defer taskContext.Span.End()
+
+	taskContext.Span.AddEvent("Compensation dead-lettered", trace.WithAttributes(
+		attribute.String("queue", queue),
+		attribute.String("task_id", taskID),
+		attribute.Int("order_id", int(p.OrderID)),
+		attribute.Int("retried", retried),
+		attribute.String("error", err.Error()),
+	))
+	taskContext.TaskFailed(err)
+
+	deadLetter := DeadLetter{
+		Type:     t.Type(),
+		Queue:    queue,
+		TaskID:   taskID,
+		Payload:  t.Payload(),
+		Error:    err.Error(),
+		Retried:  retried,
+		FailedAt: time.Now(),
+	}
+
+	payload, err := json.Marshal(deadLetter)
+	if err != nil {
+		log.Println("Failed to marshal dead letter:", err)
+		return
+	}
+
+	task := asynq.NewTask("task:dead_letter", payload, asynq.MaxRetry(0))
+	if _, err := taskContext.AsynqClient.Enqueue(task, asynq.Queue(taskContext.DeadLetterQueue)); err != nil {
+		log.Println("Failed to enqueue dead letter:", err)
+		return
+	}
+
+	log.Printf("Compensation %s dead-lettered to %s\n", taskID, taskContext.DeadLetterQueue)
+}
+
+func ListDeadLetters(inspector *asynq.Inspector, deadLetterQueue string) ([]DeadLetterInfo, error) {
+	var deadLetters []DeadLetterInfo
+
+	for page := 1; ; page++ {
+		infos, err := inspector.ListPendingTasks(deadLetterQueue, asynq.Page(page), asynq.PageSize(100))
+		if err != nil {
+			if errors.Is(err, asynq.ErrQueueNotFound) {
+				return deadLetters, nil
+			}
+			return nil, err
+		}
+
+		for _, info := range infos {
+			var deadLetter DeadLetter
+			if err := json.Unmarshal(info.Payload, &deadLetter); err != nil {
+				log.Println("Skipping malformed dead letter:", info.ID)
+				continue
+			}
+			deadLetters = append(deadLetters, DeadLetterInfo{ID: info.ID, DeadLetter: deadLetter})
+		}
+
+		if len(infos) < 100 {
+			return deadLetters, nil
+		}
+	}
+}
+
+// ReplayDeadLetter enqueues the compensation on its original queue again and
+// removes it from the dead-letter queue.
+func ReplayDeadLetter(client *asynq.Client, inspector *asynq.Inspector, deadLetterQueue string, id string) error {
+	info, err := inspector.GetTaskInfo(deadLetterQueue, id)
+	if err != nil {
+		return err
+	}
+
+	var deadLetter DeadLetter
+	if err := json.Unmarshal(info.Payload, &deadLetter); err != nil {
+		return fmt.Errorf("Malformed dead letter %s: %w", id, err)
+	}
+
+	opts := CompensationOptions(deadLetter.Queue)
+	if len(deadLetter.TaskID) > 0 {
+		if err := deleteArchived(inspector, deadLetter.Queue, deadLetter.TaskID); err != nil {
+			return err
+		}
+		opts = append(opts, asynq.TaskID(deadLetter.TaskID))
+	}
+
+	task := asynq.NewTask(deadLetter.Type, deadLetter.Payload)
+	if _, err := client.Enqueue(task, opts...); err != nil && !IsDuplicate(err) {
+		return err
+	}
+
+	return inspector.DeleteTask(deadLetterQueue, id)
+}
+
+// deleteArchived frees the ID of a dead-lettered compensation, so the replay
+// and the steps enqueuing the same revert aren't deduplicated against it.
+// NOTE(Appy): asynq archives the task after DeadLetterHandler returned, the
+// handler can't delete it.
+func deleteArchived(inspector *asynq.Inspector, queue string, taskID string) error {
+	info, err := inspector.GetTaskInfo(queue, taskID)
+	if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.State != asynq.TaskStateArchived {
+		return nil
+	}
+	return inspector.DeleteTask(queue, taskID)
+}
@@ -0,0 +1,56 @@
+package tasks
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hibiken/asynq"
+)
+
+func TestReplayDeadLetter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := asynq.NewClient(asynq.RedisClientOpt{Addr: mr.Addr()})
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{Addr: mr.Addr()})
+	defer client.Close()
+	defer inspector.Close()
+
+	// The compensation exhausted its retries, asynq archived it.
+	taskID := StepTaskID("saga-42", "inventory", REVERT)
+	revert := asynq.NewTask("task:revert", []byte(`{"order_id":42}`))
+	if _, err := client.Enqueue(revert, append(CompensationOptions("inventory"), asynq.TaskID(taskID))...); err != nil {
+		t.Fatal(err)
+	}
+	if err := inspector.ArchiveTask("inventory", taskID); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, _ := json.Marshal(DeadLetter{
+		Type:     "task:revert",
+		Queue:    "inventory",
+		TaskID:   taskID,
+		Payload:  revert.Payload(),
+		FailedAt: time.Now(),
+	})
+	info, err := client.Enqueue(asynq.NewTask("task:dead_letter", payload), asynq.Queue("dead_letters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReplayDeadLetter(client, inspector, "dead_letters", info.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := inspector.GetTaskInfo("inventory", taskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.State != asynq.TaskStatePending || replayed.MaxRetry != COMPENSATION_MAX_RETRY {
+		t.Errorf("replayed %s with %d retries, want pending with %d", replayed.State, replayed.MaxRetry, COMPENSATION_MAX_RETRY)
+	}
+
+	if deadLetters, _ := ListDeadLetters(inspector, "dead_letters"); len(deadLetters) != 0 {
+		t.Errorf("dead letters left: %v", deadLetters)
+	}
+}
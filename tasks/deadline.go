@@ -0,0 +1,139 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/events"
+	"github.com/hibiken/asynq"
+)
+
+//----------------------------------------------
+// End-to-end saga deadline.
+//---------------------------------------------
+
+const (
+	// Extra time given to asynq past the saga deadline, so the step itself gets
+	// to refuse the work and compensate.
+	SAGA_DEADLINE_GRACE = 5 * time.Second
+
+	CLAIM_KEY_PREFIX = "saga:claimed"
+
+	// Long enough to outlive the task.
+	CLAIM_TTL = 24 * time.Hour
+)
+
+var ErrSagaExpired = errors.New("Saga deadline exceeded")
+
+// StartDeadline sets the deadline of a saga that doesn't have one yet.
+func (p *SagaPayload) StartDeadline(timeout time.Duration) {
+	if p.Deadline == 0 && timeout > 0 {
+		p.Deadline = time.Now().Add(timeout).UnixMilli()
+	}
+}
+
+func (p SagaPayload) DeadlineTime() time.Time {
+	return time.UnixMilli(p.Deadline)
+}
+
+func (p SagaPayload) Expired() bool {
+	return p.Deadline != 0 && time.Now().After(p.DeadlineTime())
+}
+
+// HandoffTimeout is how long to wait for the next step, never past the deadline.
+func (p SagaPayload) HandoffTimeout() time.Duration {
+	if p.Deadline == 0 {
+		return TIMEOUT
+	}
+
+	remaining := time.Until(p.DeadlineTime())
+	if remaining < 0 {
+		return 0
+	}
+	if remaining < TIMEOUT {
+		return remaining
+	}
+	return TIMEOUT
+}
+
+// DeadlineOptions are added to every "task:perform" of the saga. Compensations
+// never get a deadline, they must run even after the saga expired.
+func (p SagaPayload) DeadlineOptions() []asynq.Option {
+	if p.Deadline == 0 {
+		return nil
+	}
+	return []asynq.Option{asynq.Deadline(p.DeadlineTime().Add(SAGA_DEADLINE_GRACE))}
+}
+
+// WithDeadline bounds the context of the step by the saga deadline.
+func (p SagaPayload) WithDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.Deadline == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, p.DeadlineTime())
+}
+
+// RefuseExpired fails the order and compensates the previous steps instead of
+// starting work on an expired saga.
+func RefuseExpired(p StepPayload, ctx *TaskContext) error {
+	ctx.Span.AddEvent(fmt.Sprintf("Saga expired at %s, refusing to start", p.DeadlineTime().Format(time.RFC3339Nano)))
+	ctx.TaskFailed(ErrSagaExpired)
+
+	errStatus := ctx.OrderClient.SetFailed(ctx.TraceContext(), p.OrderID, order.FAIL)
+	if errStatus != nil {
+		errStatus = fmt.Errorf("Failed to set order status")
+	}
+
+	PublishPaymentEvent(p, ctx, events.PAYMENT_FAILED, nil, ErrSagaExpired)
+	return errors.Join(ErrSagaExpired, errStatus, RevertPrevious(p, p.Message(), ctx))
+}
+
+// ClaimTask makes sure a single one of the perform handler and the expiry
+// handler works on a task. Returns true if this call claimed it, or if Redis
+// can't tell.
+func (t TaskContext) ClaimTask(ctx context.Context) bool {
+	taskID, ok := asynq.GetTaskID(ctx)
+	if !ok || t.RedisClient == nil {
+		return true
+	}
+
+	key := fmt.Sprintf("%s:%s:%s", CLAIM_KEY_PREFIX, t.ServerQueue, taskID)
+	claimed, err := t.RedisClient.SetNX(context.Background(), key, 1, CLAIM_TTL).Result()
+	if err != nil {
+		log.Println("Failed to claim task:", err)
+		return true
+	}
+
+	return claimed
+}
+
+// SagaExpiredHandler satisfies asynq.ErrorHandlerFunc. asynq drops a task past
+// its deadline without calling the handler, the previous steps still have to
+// be compensated.
+func SagaExpiredHandler(ctx context.Context, t *asynq.Task, err error) {
+	if t.Type() != "task:perform" || !errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	p, decodeErr := DecodeStepPayload(t.Payload())
+	if decodeErr != nil || !p.Expired() {
+		return
+	}
+
+	// NOTE(Appy): asynq also gets here when the deadline passes while the
+	// handler is still running. The handler is bound by the saga deadline, it
+	// compensates by itself.
+	taskContext := GetTaskContext(ctx)
+	if !taskContext.ClaimTask(ctx) {
+		return
+	}
+
+	fetchSpan(&p, context.Background(), taskContext, PERFORM)
+	defer taskContext.Span.End()
+
+	RefuseExpired(p, taskContext)
+}
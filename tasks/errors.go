@@ -0,0 +1,56 @@
+package tasks
+
+//----------------------------------------------
+// Error classification.
+//---------------------------------------------
+
+// BusinessError is a failure caused by the order itself, such as insufficient
+// funds or an unknown token. The dependencies worked, so it never counts
+// against a circuit breaker, and retrying the task can't change the outcome.
+type BusinessError struct {
+	Err error
+}
+
+func (e *BusinessError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BusinessError) Unwrap() error {
+	return e.Err
+}
+
+func NewBusinessError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &BusinessError{Err: err}
+}
+
+// IsBusinessError reports whether every error joined into err is a business
+// error. Any other error is an infrastructure error: a failed compensation
+// joined to insufficient funds still says the dependencies are unhealthy.
+func IsBusinessError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch e := err.(type) {
+	case *BusinessError:
+		return true
+	case interface{ Unwrap() []error }:
+		for _, joined := range e.Unwrap() {
+			if joined != nil && !IsBusinessError(joined) {
+				return false
+			}
+		}
+		return len(e.Unwrap()) > 0
+	case interface{ Unwrap() error }:
+		return IsBusinessError(e.Unwrap())
+	default:
+		return false
+	}
+}
+
+func IsInfrastructureError(err error) bool {
+	return err != nil && !IsBusinessError(err)
+}
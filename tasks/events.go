@@ -0,0 +1,48 @@
+package tasks
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/alex-appy-love-story/worker-template/events"
+	"github.com/shopspring/decimal"
+)
+
+// PublishPaymentEvent appends the event to the stream and posts it to the
+// webhooks. It never fails the step, an event that can't be published is
+// logged on the span. total is nil if the order wasn't priced.
+func PublishPaymentEvent(p StepPayload, ctx *TaskContext, eventType string, total *decimal.Decimal, reason error) {
+	event := events.PaymentEvent{
+		ID:       events.NewEventID(eventType, p.SagaKey()),
+		Type:     eventType,
+		SagaID:   p.SagaID,
+		OrderID:  p.OrderID,
+		Username: p.Username,
+		TokenID:  p.TokenID,
+		Amount:   p.Amount,
+	}
+
+	if total != nil {
+		event.Total = total.String()
+	}
+
+	if reason != nil {
+		event.Reason = reason.Error()
+	}
+
+	event.Stamp(ctx.TraceContext())
+
+	if ctx.EventPublisher != nil {
+		if err := ctx.EventPublisher.Publish(ctx.TraceContext(), event); err != nil {
+			log.Printf("Failed to publish %s: %v\n", eventType, err)
+			ctx.Span.AddEvent(fmt.Sprintf("Failed to publish %s: %s", eventType, err.Error()))
+		}
+	}
+
+	if ctx.Webhooks != nil {
+		if err := ctx.Webhooks.Dispatch(ctx.TraceContext(), event, ctx.Transaction); err != nil {
+			log.Printf("Failed to dispatch %s to the webhooks: %v\n", eventType, err)
+			ctx.Span.AddEvent(fmt.Sprintf("Failed to dispatch %s to the webhooks: %s", eventType, err.Error()))
+		}
+	}
+}
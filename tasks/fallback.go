@@ -0,0 +1,105 @@
+package tasks
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alex-appy-love-story/worker-template/circuitbreaker"
+	"github.com/hibiken/asynq"
+)
+
+//----------------------------------------------
+// Circuit breaker fallbacks.
+//---------------------------------------------
+
+const (
+	// FALLBACK_REJECT fails the order with DEFAULT_RESPONSE and compensates.
+	FALLBACK_REJECT = "reject"
+
+	// FALLBACK_DEFER enqueues the step again for when the circuit closes.
+	FALLBACK_DEFER = "defer"
+
+	// FALLBACK_DEGRADE charges anyway and parks the handoff while the next
+	// queue is open, instead of compensating.
+	FALLBACK_DEGRADE = "degrade"
+
+	// Shortest delay of a deferred or parked task, a half-open circuit has no
+	// retry time.
+	FALLBACK_MIN_DELAY = time.Second
+)
+
+func IsFallback(fallback string) bool {
+	switch fallback {
+	case FALLBACK_REJECT, FALLBACK_DEFER, FALLBACK_DEGRADE:
+		return true
+	default:
+		return false
+	}
+}
+
+// fallbackDelay is how long to wait for the breaker to let tasks through again.
+func fallbackDelay(cb *circuitbreaker.CB) time.Duration {
+	delay := cb.RetryIn()
+	if delay < FALLBACK_MIN_DELAY {
+		return FALLBACK_MIN_DELAY
+	}
+	return delay
+}
+
+// DeferPerform enqueues the step again for when the database breaker lets
+// tasks through. Returns false if the task must be rejected instead.
+func DeferPerform(p StepPayload, ctx *TaskContext) bool {
+	// NOTE(Appy): The orchestrator would time the step out and compensate.
+	if p.Orchestrated() {
+		log.Println("Can't defer an orchestrated step, rejecting")
+		return false
+	}
+
+	delay := fallbackDelay(ctx.Breakers.Get(circuitbreaker.DATABASE))
+	if p.Deadline != 0 && time.Now().Add(delay).After(p.DeadlineTime()) {
+		ctx.Span.AddEvent("Circuit open past the saga deadline, rejecting")
+		return false
+	}
+
+	task, err := NewStepTask("task:perform", p.SagaID, p.Message(), ctx)
+	if err != nil {
+		log.Println("Failed to defer task:", err)
+		return false
+	}
+
+	// Every deferral gets its own task ID, the running task still holds the original one.
+	taskID := StepTaskID(p.SagaKey(), ctx.ServerQueue, fmt.Sprintf("%s:deferred:%d", PERFORM, time.Now().UnixMilli()))
+
+	opts := append(p.DeadlineOptions(), asynq.Queue(ctx.ServerQueue), asynq.MaxRetry(0), asynq.TaskID(taskID), asynq.ProcessIn(delay))
+	if _, err := ctx.AsynqClient.Enqueue(task, opts...); err != nil {
+		log.Println("Failed to defer task:", err)
+		return false
+	}
+
+	ctx.Span.AddEvent(fmt.Sprintf("Circuit open, deferred by %s", delay))
+	return true
+}
+
+// ParkHandoff enqueues the next step for when its queue breaker lets tasks
+// through, without waiting for it to be picked up. Returns false if the
+// handoff can't be parked.
+func ParkHandoff(p StepPayload, task *asynq.Task, taskID string, ctx *TaskContext) bool {
+	delay := fallbackDelay(ctx.QueueBreaker())
+	if p.Deadline != 0 && time.Now().Add(delay).After(p.DeadlineTime()) {
+		ctx.Span.AddEvent(fmt.Sprintf("Circuit open for %s past the saga deadline", ctx.NextQueue))
+		return false
+	}
+
+	opts := append(p.DeadlineOptions(), asynq.Queue(ctx.NextQueue), asynq.MaxRetry(0), asynq.TaskID(taskID), asynq.ProcessIn(delay))
+	_, err := ctx.AsynqClient.Enqueue(task, opts...)
+	if err != nil && !IsDuplicate(err) {
+		log.Println("Failed to park handoff:", err)
+		return false
+	}
+
+	// NOTE(Appy): Past the deadline the next step refuses the task and
+	// compensates this one.
+	ctx.Span.AddEvent(fmt.Sprintf("Circuit open for %s, handoff parked for %s", ctx.NextQueue, delay))
+	return true
+}
@@ -0,0 +1,131 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/hibiken/asynq"
+)
+
+type branchResult struct {
+	queue string
+	state TaskState
+	err   error
+}
+
+// PerformFanOut hands the payload to every next queue concurrently and waits
+// until all of them picked it up. If any branch fails, the step reverts itself,
+// which compensates the branches that did pick up the task.
+func PerformFanOut(stepPayload StepPayload, body OrderMessage, ctx *TaskContext) error {
+	task, err := NewStepTask("task:perform", stepPayload.SagaID, body, ctx)
+	if err != nil {
+		log.Printf("Order %d: failed to marshal fan out payload: %s\n", stepPayload.OrderID, err)
+		return errors.Join(err, RevertSelf(stepPayload, ctx))
+	}
+
+	if err := ctx.Ctx.Err(); err != nil {
+		return errors.Join(err, RevertSelf(stepPayload, ctx))
+	}
+
+	results := make(chan branchResult, len(ctx.NextQueues))
+
+	for _, queue := range ctx.NextQueues {
+		go func(queue string) {
+			// Each branch tracks its own queue.
+			branchCtx := *ctx
+			branchCtx.NextQueue = queue
+
+			taskID := StepTaskID(stepPayload.SagaKey(), queue, PERFORM)
+
+			if !branchCtx.QueueBreaker().AllowContext(branchCtx.TraceContext()) {
+				results <- branchResult{queue, Expired, fmt.Errorf("Circuit open for %s", queue)}
+				return
+			}
+
+			opts := append(stepPayload.DeadlineOptions(), asynq.Queue(queue), asynq.MaxRetry(0), asynq.TaskID(taskID))
+			opts = append(opts, ctx.Chaos.HandoffOptions(&branchCtx)...)
+			_, err := ctx.AsynqClient.Enqueue(task, opts...)
+			if IsDuplicate(err) {
+				log.Printf("Order %d: task %s already enqueued to %s\n", stepPayload.OrderID, taskID, queue)
+			} else if err != nil {
+				log.Printf("Order %d: failed to enqueue task %s to %s: %s\n", stepPayload.OrderID, taskID, queue, err)
+				branchCtx.QueueBreaker().ReportContext(branchCtx.TraceContext(), false, 0)
+				results <- branchResult{queue, Expired, err}
+				return
+			}
+
+			branchCtx.TaskState, err = GetTaskState(stepPayload.HandoffTimeout(), taskID, &branchCtx)
+			branchCtx.AddSpanStateEvent()
+
+			results <- branchResult{queue, branchCtx.TaskState, err}
+		}(queue)
+	}
+
+	var errs error
+	var succeeded []string
+	branchFailed := false
+
+	for range ctx.NextQueues {
+		res := <-results
+		switch res.state {
+		case Done:
+			succeeded = append(succeeded, res.queue)
+			continue
+		case Failed:
+			branchFailed = true
+		}
+		ctx.TaskState = res.state
+		errs = errors.Join(errs, fmt.Errorf("%s: %w", res.queue, res.err))
+	}
+
+	if errs == nil {
+		return nil
+	}
+
+	// NOTE(Appy): A failed branch calls revert on us, which compensates its siblings.
+	if !branchFailed {
+		stepPayload.Branches = succeeded
+		errs = errors.Join(errs, RevertSelf(stepPayload, ctx))
+	}
+
+	return errs
+}
+
+// RevertBranches compensates the branches of a fan-out, except the one that
+// asked for the revert. The branches don't propagate the revert upstream.
+func RevertBranches(stepPayload StepPayload, ctx *TaskContext) error {
+	if len(ctx.NextQueues) < 2 || stepPayload.Orchestrated() {
+		return nil
+	}
+
+	branches := ctx.NextQueues
+	if stepPayload.RevertedBy == ctx.ServerQueue {
+		branches = stepPayload.Branches
+	}
+
+	body := stepPayload.Message()
+	body.SkipPrevious = true
+
+	task, err := NewStepTask("task:revert", stepPayload.SagaID, body, ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, queue := range branches {
+		if queue == stepPayload.RevertedBy {
+			continue
+		}
+
+		log.Println("Compensating branch:", queue)
+		ctx.Span.AddEvent(fmt.Sprintf("Compensating branch %s", queue))
+
+		taskID := StepTaskID(stepPayload.SagaKey(), queue, REVERT)
+		if err := EnqueueCompensation(task, queue, taskID, ctx); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+
+	return errs
+}
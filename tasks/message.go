@@ -0,0 +1,172 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+)
+
+//----------------------------------------------
+// Message envelope.
+//---------------------------------------------
+
+const (
+	// SCHEMA_V0 is the flat json map sent before the envelope existed.
+	SCHEMA_V0 = 0
+	SCHEMA_V1 = 1
+
+	// SCHEMA_VERSION is the latest version, decoded by every step. It is only
+	// written once the service is set to, SCHEMA_V0 is written by default.
+	SCHEMA_VERSION = SCHEMA_V1
+)
+
+// NOTE(Appy): A step must never write a version its neighbours can't decode.
+// Upgrade in this order: deploy every step and the orchestrator with the new
+// decoder first, still writing v0, then set SCHEMA_WRITE_VERSION=1 once all
+// of them run it. Roll back the other way around.
+
+// Envelope wraps the body of every task exchanged between the steps. The
+// envelope is always json, the body is encoded with its content type, json if
+// empty.
+type Envelope struct {
+	Version     int             `json:"version"`
+	ContentType string          `json:"content_type,omitempty"`
+	SagaID      string          `json:"saga_id,omitempty"`
+	Step        string          `json:"step"` // Queue of the step that sent the message.
+	Body        json.RawMessage `json:"body"`
+}
+
+// OrderMessage is the body of "task:perform", "task:revert" and "task:saga".
+type OrderMessage struct {
+	SagaPayload
+
+	OrderID  uint   `json:"order_id"`
+	Username string `json:"username"`
+	TokenID  uint   `json:"token_id"`
+	Amount   uint   `json:"amount"`
+}
+
+func NewEnvelope(version int, contentType string, sagaID string, step string, body interface{}) (Envelope, error) {
+	// v0 was always json.
+	if len(contentType) == 0 || version == SCHEMA_V0 {
+		contentType = CONTENT_TYPE_JSON
+	}
+
+	b, err := encodeBody(contentType, body)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		Version:     version,
+		ContentType: contentType,
+		SagaID:      sagaID,
+		Step:        step,
+		Body:        b,
+	}, nil
+}
+
+// DecodeEnvelope decodes the current and every older version of the envelope,
+// with any of the supported content types.
+func DecodeEnvelope(data []byte) (Envelope, error) {
+	var probe struct {
+		Version *int   `json:"version"`
+		SagaID  string `json:"saga_id"`
+		Step    string `json:"step"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return Envelope{}, err
+	}
+
+	// NOTE(Appy): v0 had no envelope, the whole payload is the body.
+	if probe.Version == nil {
+		return Envelope{
+			Version:     SCHEMA_V0,
+			ContentType: CONTENT_TYPE_JSON,
+			SagaID:      probe.SagaID,
+			Step:        probe.Step,
+			Body:        data,
+		}, nil
+	}
+
+	if *probe.Version > SCHEMA_VERSION {
+		return Envelope{}, fmt.Errorf("Unsupported schema version: %d", *probe.Version)
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Envelope{}, err
+	}
+
+	if len(env.ContentType) == 0 {
+		env.ContentType = CONTENT_TYPE_JSON
+	}
+
+	body, err := unwrapBody(env.ContentType, env.Body)
+	if err != nil {
+		return Envelope{}, err
+	}
+	env.Body = body
+
+	return env, nil
+}
+
+func (e Envelope) DecodeBody(v interface{}) error {
+	if e.ContentType == CONTENT_TYPE_PROTOBUF {
+		return decodeProtoBody(e.Body, v)
+	}
+	return json.Unmarshal(e.Body, v)
+}
+
+// NewStepTask wraps the body in an envelope sent from the current step.
+func NewStepTask(typename string, sagaID string, body interface{}, ctx *TaskContext) (*asynq.Task, error) {
+	env, err := NewEnvelope(ctx.SchemaVersion, ctx.ContentType, sagaID, ctx.ServerQueue, body)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := env.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(typename, p, asynq.MaxRetry(0)), nil
+}
+
+// DecodeStepPayload decodes the payload of "task:perform" and "task:revert".
+func DecodeStepPayload(data []byte) (StepPayload, error) {
+	var p StepPayload
+
+	env, err := DecodeEnvelope(data)
+	if err != nil {
+		return p, err
+	}
+
+	if err := env.DecodeBody(&p); err != nil {
+		return p, err
+	}
+	p.SagaID = env.SagaID
+
+	return p, nil
+}
+
+// Message returns the order carried from step to step. Fan-out bookkeeping is
+// left out, it only concerns the step that sets it.
+func (p StepPayload) Message() OrderMessage {
+	return OrderMessage{
+		SagaPayload: SagaPayload{
+			FailTrigger:  p.FailTrigger,
+			Chaos:        p.Chaos,
+			SagaID:       p.SagaID,
+			ReplyQueue:   p.ReplyQueue,
+			Attempt:      p.Attempt,
+			Deadline:     p.Deadline,
+			TraceCarrier: p.TraceCarrier,
+		},
+		OrderID:  p.OrderID,
+		Username: p.Username,
+		TokenID:  p.TokenID,
+		Amount:   p.Amount,
+	}
+}
@@ -0,0 +1,257 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+var traceCarrier = propagation.MapCarrier{
+	"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+}
+
+func performMessage() OrderMessage {
+	return OrderMessage{
+		SagaPayload: SagaPayload{
+			FailTrigger: "inventory",
+			Chaos: []ChaosSpec{
+				{Target: "payment", LatencyMs: 200, FailureRate: 0.1, Seed: 42},
+			},
+			Deadline:     1700000000000,
+			TraceCarrier: traceCarrier,
+		},
+		OrderID:  4242,
+		Username: "appy",
+		TokenID:  3,
+		Amount:   2,
+	}
+}
+
+func revertMessage() OrderMessage {
+	return OrderMessage{
+		SagaPayload: SagaPayload{
+			FailTrigger:  "inventory",
+			RevertedBy:   "inventory",
+			Branches:     []string{"inventory", "shipping"},
+			SkipPrevious: true,
+			TraceCarrier: traceCarrier,
+		},
+		OrderID:  4242,
+		Username: "appy",
+		TokenID:  3,
+		Amount:   2,
+	}
+}
+
+func orchestratedMessage() OrderMessage {
+	m := performMessage()
+	m.ReplyQueue = "orchestrator"
+	m.Attempt = 2
+	return m
+}
+
+func stepReply() StepReply {
+	payload := orchestratedMessage()
+	return StepReply{
+		Action:       PERFORM,
+		Attempt:      2,
+		Success:      true,
+		Payload:      &payload,
+		TraceCarrier: traceCarrier,
+	}
+}
+
+// decoded returns every field of the payload, fan-out bookkeeping included.
+func decoded(p StepPayload) OrderMessage {
+	return OrderMessage{
+		SagaPayload: p.SagaPayload,
+		OrderID:     p.OrderID,
+		Username:    p.Username,
+		TokenID:     p.TokenID,
+		Amount:      p.Amount,
+	}
+}
+
+// golden compares the payload to testdata/<name>.golden, or rewrites it with -update.
+func golden(t *testing.T, name string, payload []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, append(payload, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(bytes.TrimSpace(want), payload) {
+		t.Errorf("%s changed, a step running the previous version may not decode it:\ngot:  %s\nwant: %s", path, payload, bytes.TrimSpace(want))
+	}
+}
+
+func marshal(t *testing.T, version int, contentType string, sagaID string, body interface{}) []byte {
+	t.Helper()
+
+	env, err := NewEnvelope(version, contentType, sagaID, "payment", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := env.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func TestOrderMessageGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		sagaID  string
+		message OrderMessage
+	}{
+		{"perform.v1", "", performMessage()},
+		{"revert.v1", "", revertMessage()},
+		{"orchestrated.v1", "saga-4242", orchestratedMessage()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := marshal(t, SCHEMA_V1, CONTENT_TYPE_JSON, tt.sagaID, tt.message)
+			golden(t, tt.name, payload)
+
+			p, err := DecodeStepPayload(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := tt.message
+			want.SagaID = tt.sagaID
+			if got := decoded(p); !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestStepReplyGolden(t *testing.T) {
+	payload := marshal(t, SCHEMA_V1, CONTENT_TYPE_JSON, "saga-4242", stepReply())
+	golden(t, "reply.v1", payload)
+
+	r, err := DecodeStepReply(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := stepReply()
+	want.SagaID = "saga-4242"
+	want.Step = "payment"
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("decoded %+v, want %+v", r, want)
+	}
+}
+
+func TestDecodeV0(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    OrderMessage
+	}{
+		{
+			// Sent by PerformNext.
+			name:    "perform",
+			payload: `{"amount":2,"token_id":3,"username":"appy","order_id":4242,"fail_trigger":"inventory","trace_carrier":{"traceparent":"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}}`,
+			want: OrderMessage{
+				SagaPayload: SagaPayload{FailTrigger: "inventory", TraceCarrier: traceCarrier},
+				OrderID:     4242,
+				Username:    "appy",
+				TokenID:     3,
+				Amount:      2,
+			},
+		},
+		{
+			// Sent by Revert, without the fail trigger.
+			name:    "revert",
+			payload: `{"order_id":4242,"trace_carrier":{"traceparent":"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}}`,
+			want: OrderMessage{
+				SagaPayload: SagaPayload{TraceCarrier: traceCarrier},
+				OrderID:     4242,
+			},
+		},
+		{
+			// Sent when the circuit breaker was open.
+			name:    "circuit open",
+			payload: `{"amount":2,"username":"appy","token_id":3,"order_id":4242,"trace_carrier":{}}`,
+			want: OrderMessage{
+				SagaPayload: SagaPayload{TraceCarrier: propagation.MapCarrier{}},
+				OrderID:     4242,
+				Username:    "appy",
+				TokenID:     3,
+				Amount:      2,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := DecodeEnvelope([]byte(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.Version != SCHEMA_V0 || env.ContentType != CONTENT_TYPE_JSON {
+				t.Errorf("decoded version %d %s, want v0 json", env.Version, env.ContentType)
+			}
+
+			p, err := DecodeStepPayload([]byte(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := decoded(p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoded %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A v0 payload must stay readable by a step which unmarshals it directly.
+func TestWriteV0(t *testing.T) {
+	message := performMessage()
+	payload := marshal(t, SCHEMA_V0, CONTENT_TYPE_PROTOBUF, "saga-4242", message)
+
+	var legacy StepPayload
+	if err := json.Unmarshal(payload, &legacy); err != nil {
+		t.Fatalf("not a flat json map: %s", err)
+	}
+	if legacy.OrderID != message.OrderID || legacy.TokenID != message.TokenID ||
+		legacy.Amount != message.Amount || legacy.FailTrigger != message.FailTrigger {
+		t.Errorf("legacy decoder read %+v, want %+v", legacy, message)
+	}
+
+	p, err := DecodeStepPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message.SagaID = "saga-4242"
+	if got := decoded(p); !reflect.DeepEqual(got, message) {
+		t.Errorf("decoded %+v, want %+v", got, message)
+	}
+}
+
+func TestDecodeUnsupportedVersion(t *testing.T) {
+	if _, err := DecodeEnvelope([]byte(`{"version":99,"step":"payment","body":{}}`)); err == nil {
+		t.Error("decoded a version from the future")
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
+	"github.com/alex-appy-love-story/worker-template/circuitbreaker"
 	"github.com/hibiken/asynq"
 )
 
@@ -23,36 +25,50 @@ func LoggingMiddleware(h asynq.Handler) asynq.Handler {
 	})
 }
 
-func CircuitBreakerMiddleware(h asynq.Handler) asynq.Handler {
-	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
-		cb := GetTaskContext(ctx).CircuitBreaker
-		err := h.ProcessTask(ctx, t)
+// Admission is the decision of the database breaker on a task. Transaction
+// reports the outcome of the queries of an admitted task.
+type Admission struct {
+	Allowed  bool
+	reported int32
+}
 
-		fmt.Println("Task error: ", err)
+// report reports whether the caller is the first to report the outcome of
+// the admitted task, a probe only counts once.
+func (a *Admission) report() bool {
+	return a != nil && a.Allowed && atomic.CompareAndSwapInt32(&a.reported, 0, 1)
+}
 
-		if cb.IsState("open") {
-			return err
-		}
+func (a *Admission) Reported() bool {
+	return atomic.LoadInt32(&a.reported) == 1
+}
 
-		cb.Mutex().Lock()
-		defer cb.Mutex().Unlock()
+func CircuitBreakerMiddleware(h asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		cb := GetTaskContext(ctx).Breakers.Get(circuitbreaker.DATABASE)
 
-		if err == nil {
-			cb.SetFails(0)
-			cb.SetState("closed")
-			return nil
-		}
+		// NOTE(Appy): A rejected task still runs, the handler decides what to do
+		// with it, but its outcome says nothing about the dependency.
+		allowed, changes := cb.AllowTransitions()
+		admission := &Admission{Allowed: allowed}
+		ctx = context.WithValue(ctx, "circuit_open", !allowed)
+		ctx = context.WithValue(ctx, "circuit_changes", changes)
+		ctx = context.WithValue(ctx, "circuit_admission", admission)
 
-		if cb.IsState("half-open") {
-			cb.SetState("open")
-			cb.OpenChannel() <- struct{}{}
-			return err
+		err := h.ProcessTask(ctx, t)
+
+		// NOTE(Appy): Only the queries report to the database breaker, the
+		// order service and the queues have their own. A task which never
+		// reached the database gives its probe back.
+		if allowed && !admission.Reported() {
+			cb.Release()
 		}
 
-		cb.IncrementFails()
-		if cb.FailsExcceededThreshold() {
-			cb.SetState("open")
-			cb.OpenChannel() <- struct{}{}
+		// NOTE(Appy): The saga already failed the order and compensated, a
+		// retry can't change the outcome. The task is archived right away, so
+		// the previous step still sees it failed.
+		if IsBusinessError(err) {
+			log.Println("Task failed for a business reason:", err)
+			return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
 		}
 
 		return err
@@ -0,0 +1,48 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alex-appy-love-story/worker-template/circuitbreaker"
+	"github.com/hibiken/asynq"
+)
+
+func runMiddleware(t *testing.T, err error) error {
+	t.Helper()
+
+	breakers := circuitbreaker.NewRegistry(circuitbreaker.CBOptions{})
+	ctx := context.WithValue(context.Background(), "circuit_breakers", breakers)
+
+	h := CircuitBreakerMiddleware(asynq.HandlerFunc(func(context.Context, *asynq.Task) error {
+		return err
+	}))
+	return h.ProcessTask(ctx, asynq.NewTask("task:perform", nil))
+}
+
+func TestCircuitBreakerMiddlewareErrors(t *testing.T) {
+	insufficient := errors.New("Insufficient funds")
+	down := errors.New("Database down")
+
+	// A business error is archived without a retry, the previous step sees it failed.
+	err := runMiddleware(t, NewBusinessError(insufficient))
+	if !errors.Is(err, asynq.SkipRetry) {
+		t.Errorf("business error: got %v, want a SkipRetry", err)
+	}
+
+	// Joined to a failed compensation, it is retried.
+	err = runMiddleware(t, errors.Join(NewBusinessError(insufficient), down))
+	if err == nil || errors.Is(err, asynq.SkipRetry) {
+		t.Errorf("joined error: got %v, want a retry", err)
+	}
+
+	err = runMiddleware(t, down)
+	if err != down {
+		t.Errorf("infrastructure error: got %v, want %v", err, down)
+	}
+
+	if err := runMiddleware(t, nil); err != nil {
+		t.Errorf("success: got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package tasks
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hibiken/asynq"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+//----------------------------------------------
+// Orchestrator replies.
+//---------------------------------------------
+
+// StepReply is sent back to the orchestrator once a step finished its job.
+// It is only used when the saga is driven by the orchestrator, in which case
+// the step never chains to the next or previous queue by itself.
+// The saga ID and the step that replied are carried by the envelope.
+type StepReply struct {
+	SagaID  string `json:"-"`
+	Step    string `json:"-"`
+	Action  string `json:"action"` // PERFORM or REVERT.
+	Attempt int    `json:"attempt"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+
+	// Payload forwarded to the next step on success.
+	Payload *OrderMessage `json:"payload,omitempty"`
+
+	// For Otel
+	TraceCarrier propagation.MapCarrier `json:"trace_carrier,omitempty"`
+}
+
+// Orchestrated returns true if the saga is driven by the orchestrator.
+func (p SagaPayload) Orchestrated() bool {
+	return len(p.ReplyQueue) > 0
+}
+
+func SendReply(stepPayload StepPayload, success bool, payload *OrderMessage, ctx *TaskContext) error {
+	reply := StepReply{
+		Action:       ctx.Job,
+		Attempt:      stepPayload.Attempt,
+		Success:      success,
+		Payload:      payload,
+		TraceCarrier: stepPayload.TraceCarrier,
+	}
+
+	if !success {
+		reply.Error = fmt.Sprintf("%s failed on %s", ctx.Job, ctx.ServerQueue)
+	}
+
+	task, err := NewStepTask("task:reply", stepPayload.SagaID, reply, ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Replying to orchestrator: %+v\n", reply)
+
+	taskID := StepTaskID(stepPayload.SagaKey(), ctx.ServerQueue, fmt.Sprintf("%s:%d:reply", ctx.Job, stepPayload.Attempt))
+
+	_, err = ctx.AsynqClient.Enqueue(task, asynq.Queue(stepPayload.ReplyQueue), asynq.MaxRetry(0), asynq.TaskID(taskID))
+	if IsDuplicate(err) {
+		log.Println("Reply already sent:", taskID)
+		return nil
+	}
+	if err != nil {
+		// Failed to queue. The orchestrator will time out on this step.
+		return err
+	}
+
+	return nil
+}
+
+// DecodeStepReply decodes the payload of "task:reply".
+func DecodeStepReply(data []byte) (StepReply, error) {
+	var r StepReply
+
+	env, err := DecodeEnvelope(data)
+	if err != nil {
+		return r, err
+	}
+
+	if err := env.DecodeBody(&r); err != nil {
+		return r, err
+	}
+	r.SagaID = env.SagaID
+	r.Step = env.Step
+
+	return r, nil
+}
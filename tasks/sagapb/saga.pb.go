@@ -0,0 +1,685 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.31.0
+// 	protoc        (unknown)
+// source: tasks/sagapb/saga.proto
+
+package sagapb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Envelope struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Version     uint32 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	ContentType string `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	SagaId      string `protobuf:"bytes,3,opt,name=saga_id,json=sagaId,proto3" json:"saga_id,omitempty"`
+	Step        string `protobuf:"bytes,4,opt,name=step,proto3" json:"step,omitempty"`
+	Body        []byte `protobuf:"bytes,5,opt,name=body,proto3" json:"body,omitempty"`
+}
+
+func (x *Envelope) Reset() {
+	*x = Envelope{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_tasks_sagapb_saga_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Envelope) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Envelope) ProtoMessage() {}
+
+func (x *Envelope) ProtoReflect() protoreflect.Message {
+	mi := &file_tasks_sagapb_saga_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Envelope.ProtoReflect.Descriptor instead.
+func (*Envelope) Descriptor() ([]byte, []int) {
+	return file_tasks_sagapb_saga_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Envelope) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Envelope) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Envelope) GetSagaId() string {
+	if x != nil {
+		return x.SagaId
+	}
+	return ""
+}
+
+func (x *Envelope) GetStep() string {
+	if x != nil {
+		return x.Step
+	}
+	return ""
+}
+
+func (x *Envelope) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+type SagaPayload struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	FailTrigger  string            `protobuf:"bytes,1,opt,name=fail_trigger,json=failTrigger,proto3" json:"fail_trigger,omitempty"`
+	ReplyQueue   string            `protobuf:"bytes,2,opt,name=reply_queue,json=replyQueue,proto3" json:"reply_queue,omitempty"`
+	Attempt      int64             `protobuf:"varint,3,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	RevertedBy   string            `protobuf:"bytes,4,opt,name=reverted_by,json=revertedBy,proto3" json:"reverted_by,omitempty"`
+	Branches     []string          `protobuf:"bytes,5,rep,name=branches,proto3" json:"branches,omitempty"`
+	SkipPrevious bool              `protobuf:"varint,6,opt,name=skip_previous,json=skipPrevious,proto3" json:"skip_previous,omitempty"`
+	TraceCarrier map[string]string `protobuf:"bytes,7,rep,name=trace_carrier,json=traceCarrier,proto3" json:"trace_carrier,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Deadline     int64             `protobuf:"varint,8,opt,name=deadline,proto3" json:"deadline,omitempty"`
+	Chaos        []*ChaosSpec      `protobuf:"bytes,9,rep,name=chaos,proto3" json:"chaos,omitempty"`
+}
+
+func (x *SagaPayload) Reset() {
+	*x = SagaPayload{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_tasks_sagapb_saga_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SagaPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SagaPayload) ProtoMessage() {}
+
+func (x *SagaPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_tasks_sagapb_saga_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SagaPayload.ProtoReflect.Descriptor instead.
+func (*SagaPayload) Descriptor() ([]byte, []int) {
+	return file_tasks_sagapb_saga_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SagaPayload) GetFailTrigger() string {
+	if x != nil {
+		return x.FailTrigger
+	}
+	return ""
+}
+
+func (x *SagaPayload) GetReplyQueue() string {
+	if x != nil {
+		return x.ReplyQueue
+	}
+	return ""
+}
+
+func (x *SagaPayload) GetAttempt() int64 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *SagaPayload) GetRevertedBy() string {
+	if x != nil {
+		return x.RevertedBy
+	}
+	return ""
+}
+
+func (x *SagaPayload) GetBranches() []string {
+	if x != nil {
+		return x.Branches
+	}
+	return nil
+}
+
+func (x *SagaPayload) GetSkipPrevious() bool {
+	if x != nil {
+		return x.SkipPrevious
+	}
+	return false
+}
+
+func (x *SagaPayload) GetTraceCarrier() map[string]string {
+	if x != nil {
+		return x.TraceCarrier
+	}
+	return nil
+}
+
+func (x *SagaPayload) GetDeadline() int64 {
+	if x != nil {
+		return x.Deadline
+	}
+	return 0
+}
+
+func (x *SagaPayload) GetChaos() []*ChaosSpec {
+	if x != nil {
+		return x.Chaos
+	}
+	return nil
+}
+
+type ChaosSpec struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Target          string  `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	LatencyMs       int64   `protobuf:"varint,2,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
+	FailureRate     float64 `protobuf:"fixed64,3,opt,name=failure_rate,json=failureRate,proto3" json:"failure_rate,omitempty"`
+	FailAfterCommit bool    `protobuf:"varint,4,opt,name=fail_after_commit,json=failAfterCommit,proto3" json:"fail_after_commit,omitempty"`
+	FailRevert      bool    `protobuf:"varint,5,opt,name=fail_revert,json=failRevert,proto3" json:"fail_revert,omitempty"`
+	DropHandoff     bool    `protobuf:"varint,6,opt,name=drop_handoff,json=dropHandoff,proto3" json:"drop_handoff,omitempty"`
+	Seed            int64   `protobuf:"varint,7,opt,name=seed,proto3" json:"seed,omitempty"`
+}
+
+func (x *ChaosSpec) Reset() {
+	*x = ChaosSpec{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_tasks_sagapb_saga_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ChaosSpec) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChaosSpec) ProtoMessage() {}
+
+func (x *ChaosSpec) ProtoReflect() protoreflect.Message {
+	mi := &file_tasks_sagapb_saga_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChaosSpec.ProtoReflect.Descriptor instead.
+func (*ChaosSpec) Descriptor() ([]byte, []int) {
+	return file_tasks_sagapb_saga_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ChaosSpec) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *ChaosSpec) GetLatencyMs() int64 {
+	if x != nil {
+		return x.LatencyMs
+	}
+	return 0
+}
+
+func (x *ChaosSpec) GetFailureRate() float64 {
+	if x != nil {
+		return x.FailureRate
+	}
+	return 0
+}
+
+func (x *ChaosSpec) GetFailAfterCommit() bool {
+	if x != nil {
+		return x.FailAfterCommit
+	}
+	return false
+}
+
+func (x *ChaosSpec) GetFailRevert() bool {
+	if x != nil {
+		return x.FailRevert
+	}
+	return false
+}
+
+func (x *ChaosSpec) GetDropHandoff() bool {
+	if x != nil {
+		return x.DropHandoff
+	}
+	return false
+}
+
+func (x *ChaosSpec) GetSeed() int64 {
+	if x != nil {
+		return x.Seed
+	}
+	return 0
+}
+
+type OrderMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Saga     *SagaPayload `protobuf:"bytes,1,opt,name=saga,proto3" json:"saga,omitempty"`
+	OrderId  uint64       `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	Username string       `protobuf:"bytes,3,opt,name=username,proto3" json:"username,omitempty"`
+	TokenId  uint64       `protobuf:"varint,4,opt,name=token_id,json=tokenId,proto3" json:"token_id,omitempty"`
+	Amount   uint64       `protobuf:"varint,5,opt,name=amount,proto3" json:"amount,omitempty"`
+}
+
+func (x *OrderMessage) Reset() {
+	*x = OrderMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_tasks_sagapb_saga_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OrderMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderMessage) ProtoMessage() {}
+
+func (x *OrderMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_tasks_sagapb_saga_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderMessage.ProtoReflect.Descriptor instead.
+func (*OrderMessage) Descriptor() ([]byte, []int) {
+	return file_tasks_sagapb_saga_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *OrderMessage) GetSaga() *SagaPayload {
+	if x != nil {
+		return x.Saga
+	}
+	return nil
+}
+
+func (x *OrderMessage) GetOrderId() uint64 {
+	if x != nil {
+		return x.OrderId
+	}
+	return 0
+}
+
+func (x *OrderMessage) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *OrderMessage) GetTokenId() uint64 {
+	if x != nil {
+		return x.TokenId
+	}
+	return 0
+}
+
+func (x *OrderMessage) GetAmount() uint64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+type StepReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Action       string            `protobuf:"bytes,1,opt,name=action,proto3" json:"action,omitempty"`
+	Attempt      int64             `protobuf:"varint,2,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	Success      bool              `protobuf:"varint,3,opt,name=success,proto3" json:"success,omitempty"`
+	Error        string            `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	Payload      *OrderMessage     `protobuf:"bytes,5,opt,name=payload,proto3" json:"payload,omitempty"`
+	TraceCarrier map[string]string `protobuf:"bytes,6,rep,name=trace_carrier,json=traceCarrier,proto3" json:"trace_carrier,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (x *StepReply) Reset() {
+	*x = StepReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_tasks_sagapb_saga_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StepReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StepReply) ProtoMessage() {}
+
+func (x *StepReply) ProtoReflect() protoreflect.Message {
+	mi := &file_tasks_sagapb_saga_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StepReply.ProtoReflect.Descriptor instead.
+func (*StepReply) Descriptor() ([]byte, []int) {
+	return file_tasks_sagapb_saga_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *StepReply) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *StepReply) GetAttempt() int64 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *StepReply) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *StepReply) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *StepReply) GetPayload() *OrderMessage {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *StepReply) GetTraceCarrier() map[string]string {
+	if x != nil {
+		return x.TraceCarrier
+	}
+	return nil
+}
+
+var File_tasks_sagapb_saga_proto protoreflect.FileDescriptor
+
+var file_tasks_sagapb_saga_proto_rawDesc = []byte{
+	0x0a, 0x17, 0x74, 0x61, 0x73, 0x6b, 0x73, 0x2f, 0x73, 0x61, 0x67, 0x61, 0x70, 0x62, 0x2f, 0x73,
+	0x61, 0x67, 0x61, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07, 0x73, 0x61, 0x67, 0x61, 0x2e,
+	0x76, 0x31, 0x22, 0x88, 0x01, 0x0a, 0x08, 0x45, 0x6e, 0x76, 0x65, 0x6c, 0x6f, 0x70, 0x65, 0x12,
+	0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f, 0x6e,
+	0x74, 0x65, 0x6e, 0x74, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0b, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x17, 0x0a, 0x07,
+	0x73, 0x61, 0x67, 0x61, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73,
+	0x61, 0x67, 0x61, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x74, 0x65, 0x70, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x73, 0x74, 0x65, 0x70, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x6f, 0x64,
+	0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x22, 0xa1, 0x03,
+	0x0a, 0x0b, 0x53, 0x61, 0x67, 0x61, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x21, 0x0a,
+	0x0c, 0x66, 0x61, 0x69, 0x6c, 0x5f, 0x74, 0x72, 0x69, 0x67, 0x67, 0x65, 0x72, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0b, 0x66, 0x61, 0x69, 0x6c, 0x54, 0x72, 0x69, 0x67, 0x67, 0x65, 0x72,
+	0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x70, 0x6c, 0x79, 0x5f, 0x71, 0x75, 0x65, 0x75, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65, 0x70, 0x6c, 0x79, 0x51, 0x75, 0x65, 0x75,
+	0x65, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x74, 0x74, 0x65, 0x6d, 0x70, 0x74, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x07, 0x61, 0x74, 0x74, 0x65, 0x6d, 0x70, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x72,
+	0x65, 0x76, 0x65, 0x72, 0x74, 0x65, 0x64, 0x5f, 0x62, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0a, 0x72, 0x65, 0x76, 0x65, 0x72, 0x74, 0x65, 0x64, 0x42, 0x79, 0x12, 0x1a, 0x0a, 0x08,
+	0x62, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x65, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08,
+	0x62, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x65, 0x73, 0x12, 0x23, 0x0a, 0x0d, 0x73, 0x6b, 0x69, 0x70,
+	0x5f, 0x70, 0x72, 0x65, 0x76, 0x69, 0x6f, 0x75, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x0c, 0x73, 0x6b, 0x69, 0x70, 0x50, 0x72, 0x65, 0x76, 0x69, 0x6f, 0x75, 0x73, 0x12, 0x4b, 0x0a,
+	0x0d, 0x74, 0x72, 0x61, 0x63, 0x65, 0x5f, 0x63, 0x61, 0x72, 0x72, 0x69, 0x65, 0x72, 0x18, 0x07,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x26, 0x2e, 0x73, 0x61, 0x67, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x53,
+	0x61, 0x67, 0x61, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x2e, 0x54, 0x72, 0x61, 0x63, 0x65,
+	0x43, 0x61, 0x72, 0x72, 0x69, 0x65, 0x72, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0c, 0x74, 0x72,
+	0x61, 0x63, 0x65, 0x43, 0x61, 0x72, 0x72, 0x69, 0x65, 0x72, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x65,
+	0x61, 0x64, 0x6c, 0x69, 0x6e, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x64, 0x65,
+	0x61, 0x64, 0x6c, 0x69, 0x6e, 0x65, 0x12, 0x28, 0x0a, 0x05, 0x63, 0x68, 0x61, 0x6f, 0x73, 0x18,
+	0x09, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x73, 0x61, 0x67, 0x61, 0x2e, 0x76, 0x31, 0x2e,
+	0x43, 0x68, 0x61, 0x6f, 0x73, 0x53, 0x70, 0x65, 0x63, 0x52, 0x05, 0x63, 0x68, 0x61, 0x6f, 0x73,
+	0x1a, 0x3f, 0x0a, 0x11, 0x54, 0x72, 0x61, 0x63, 0x65, 0x43, 0x61, 0x72, 0x72, 0x69, 0x65, 0x72,
+	0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38,
+	0x01, 0x22, 0xe9, 0x01, 0x0a, 0x09, 0x43, 0x68, 0x61, 0x6f, 0x73, 0x53, 0x70, 0x65, 0x63, 0x12,
+	0x16, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x6c, 0x61, 0x74, 0x65, 0x6e,
+	0x63, 0x79, 0x5f, 0x6d, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x6c, 0x61, 0x74,
+	0x65, 0x6e, 0x63, 0x79, 0x4d, 0x73, 0x12, 0x21, 0x0a, 0x0c, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72,
+	0x65, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0b, 0x66, 0x61,
+	0x69, 0x6c, 0x75, 0x72, 0x65, 0x52, 0x61, 0x74, 0x65, 0x12, 0x2a, 0x0a, 0x11, 0x66, 0x61, 0x69,
+	0x6c, 0x5f, 0x61, 0x66, 0x74, 0x65, 0x72, 0x5f, 0x63, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x66, 0x61, 0x69, 0x6c, 0x41, 0x66, 0x74, 0x65, 0x72, 0x43,
+	0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x66, 0x61, 0x69, 0x6c, 0x5f, 0x72, 0x65,
+	0x76, 0x65, 0x72, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x66, 0x61, 0x69, 0x6c,
+	0x52, 0x65, 0x76, 0x65, 0x72, 0x74, 0x12, 0x21, 0x0a, 0x0c, 0x64, 0x72, 0x6f, 0x70, 0x5f, 0x68,
+	0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b, 0x64, 0x72,
+	0x6f, 0x70, 0x48, 0x61, 0x6e, 0x64, 0x6f, 0x66, 0x66, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x65,
+	0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x73, 0x65, 0x65, 0x64, 0x22, 0xa2, 0x01,
+	0x0a, 0x0c, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x28,
+	0x0a, 0x04, 0x73, 0x61, 0x67, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x73,
+	0x61, 0x67, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x61, 0x67, 0x61, 0x50, 0x61, 0x79, 0x6c, 0x6f,
+	0x61, 0x64, 0x52, 0x04, 0x73, 0x61, 0x67, 0x61, 0x12, 0x19, 0x0a, 0x08, 0x6f, 0x72, 0x64, 0x65,
+	0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x6f, 0x72, 0x64, 0x65,
+	0x72, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x12,
+	0x19, 0x0a, 0x08, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x07, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x49, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x61, 0x6d,
+	0x6f, 0x75, 0x6e, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x61, 0x6d, 0x6f, 0x75,
+	0x6e, 0x74, 0x22, 0xaa, 0x02, 0x0a, 0x09, 0x53, 0x74, 0x65, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79,
+	0x12, 0x16, 0x0a, 0x06, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x74, 0x74, 0x65,
+	0x6d, 0x70, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x61, 0x74, 0x74, 0x65, 0x6d,
+	0x70, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x12, 0x14, 0x0a, 0x05,
+	0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72,
+	0x6f, 0x72, 0x12, 0x2f, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x73, 0x61, 0x67, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x4f, 0x72,
+	0x64, 0x65, 0x72, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52, 0x07, 0x70, 0x61, 0x79, 0x6c,
+	0x6f, 0x61, 0x64, 0x12, 0x49, 0x0a, 0x0d, 0x74, 0x72, 0x61, 0x63, 0x65, 0x5f, 0x63, 0x61, 0x72,
+	0x72, 0x69, 0x65, 0x72, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x24, 0x2e, 0x73, 0x61, 0x67,
+	0x61, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x65, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x2e, 0x54,
+	0x72, 0x61, 0x63, 0x65, 0x43, 0x61, 0x72, 0x72, 0x69, 0x65, 0x72, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x52, 0x0c, 0x74, 0x72, 0x61, 0x63, 0x65, 0x43, 0x61, 0x72, 0x72, 0x69, 0x65, 0x72, 0x1a, 0x3f,
+	0x0a, 0x11, 0x54, 0x72, 0x61, 0x63, 0x65, 0x43, 0x61, 0x72, 0x72, 0x69, 0x65, 0x72, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x42,
+	0x3e, 0x5a, 0x3c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x6c,
+	0x65, 0x78, 0x2d, 0x61, 0x70, 0x70, 0x79, 0x2d, 0x6c, 0x6f, 0x76, 0x65, 0x2d, 0x73, 0x74, 0x6f,
+	0x72, 0x79, 0x2f, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x2d, 0x74, 0x65, 0x6d, 0x70, 0x6c, 0x61,
+	0x74, 0x65, 0x2f, 0x74, 0x61, 0x73, 0x6b, 0x73, 0x2f, 0x73, 0x61, 0x67, 0x61, 0x70, 0x62, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_tasks_sagapb_saga_proto_rawDescOnce sync.Once
+	file_tasks_sagapb_saga_proto_rawDescData = file_tasks_sagapb_saga_proto_rawDesc
+)
+
+func file_tasks_sagapb_saga_proto_rawDescGZIP() []byte {
+	file_tasks_sagapb_saga_proto_rawDescOnce.Do(func() {
+		file_tasks_sagapb_saga_proto_rawDescData = protoimpl.X.CompressGZIP(file_tasks_sagapb_saga_proto_rawDescData)
+	})
+	return file_tasks_sagapb_saga_proto_rawDescData
+}
+
+var file_tasks_sagapb_saga_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_tasks_sagapb_saga_proto_goTypes = []interface{}{
+	(*Envelope)(nil),     // 0: saga.v1.Envelope
+	(*SagaPayload)(nil),  // 1: saga.v1.SagaPayload
+	(*ChaosSpec)(nil),    // 2: saga.v1.ChaosSpec
+	(*OrderMessage)(nil), // 3: saga.v1.OrderMessage
+	(*StepReply)(nil),    // 4: saga.v1.StepReply
+	nil,                  // 5: saga.v1.SagaPayload.TraceCarrierEntry
+	nil,                  // 6: saga.v1.StepReply.TraceCarrierEntry
+}
+var file_tasks_sagapb_saga_proto_depIdxs = []int32{
+	5, // 0: saga.v1.SagaPayload.trace_carrier:type_name -> saga.v1.SagaPayload.TraceCarrierEntry
+	2, // 1: saga.v1.SagaPayload.chaos:type_name -> saga.v1.ChaosSpec
+	1, // 2: saga.v1.OrderMessage.saga:type_name -> saga.v1.SagaPayload
+	3, // 3: saga.v1.StepReply.payload:type_name -> saga.v1.OrderMessage
+	6, // 4: saga.v1.StepReply.trace_carrier:type_name -> saga.v1.StepReply.TraceCarrierEntry
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_tasks_sagapb_saga_proto_init() }
+func file_tasks_sagapb_saga_proto_init() {
+	if File_tasks_sagapb_saga_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_tasks_sagapb_saga_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Envelope); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_tasks_sagapb_saga_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SagaPayload); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_tasks_sagapb_saga_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ChaosSpec); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_tasks_sagapb_saga_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*OrderMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_tasks_sagapb_saga_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StepReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_tasks_sagapb_saga_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_tasks_sagapb_saga_proto_goTypes,
+		DependencyIndexes: file_tasks_sagapb_saga_proto_depIdxs,
+		MessageInfos:      file_tasks_sagapb_saga_proto_msgTypes,
+	}.Build()
+	File_tasks_sagapb_saga_proto = out.File
+	file_tasks_sagapb_saga_proto_rawDesc = nil
+	file_tasks_sagapb_saga_proto_goTypes = nil
+	file_tasks_sagapb_saga_proto_depIdxs = nil
+}
@@ -1,11 +1,13 @@
 package tasks
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/alex-appy-love-story/db-lib/models/order"
 	"github.com/alex-appy-love-story/db-lib/models/token"
 	"github.com/alex-appy-love-story/db-lib/models/user"
+	"github.com/alex-appy-love-story/worker-template/events"
 	"github.com/shopspring/decimal"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -29,18 +31,27 @@ type StepPayload struct {
 func Perform(p StepPayload, ctx *TaskContext) (err error) {
 	ctx.Span.AddEvent("Making payment")
 
-	err = ctx.GormClient.Transaction(func(tsx *gorm.DB) error {
+	// NOTE(Appy): Set once the transaction is over, a slow order service must
+	// not hold the transaction open.
+	var failStatus order.OrderStatus
+
+	// Total cost of the order, once priced.
+	var total *decimal.Decimal
+
+	err = ctx.Transaction(func(tsx *gorm.DB) error {
 
 		tok, err := token.GetToken(tsx, p.TokenID)
 		if err != nil {
-			if err := SetOrderStatus(ctx.OrderSvcAddr, p.OrderID, order.PAYMENT_FAIL_TOKEN_NOT_FOUND); err != nil {
-				return err
+			failStatus = order.PAYMENT_FAIL_TOKEN_NOT_FOUND
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return NewBusinessError(err)
 			}
 			return err
 		}
 
 		// Retrieve the total cost of the order.
 		totalCost := tok.Cost.Mul(decimal.NewFromInt32(int32(p.Amount)))
+		total = &totalCost
 
 		ctx.Span.AddEvent("Fetching user information")
 
@@ -64,11 +75,24 @@ func Perform(p StepPayload, ctx *TaskContext) (err error) {
 		ctx.Span.AddEvent("Checking user balance")
 		// User can't afford.
 		if !usr.Balance.GreaterThanOrEqual(totalCost) {
-			err := SetOrderStatus(ctx.OrderSvcAddr, p.OrderID, order.PAYMENT_FAIL_INSUFFICIENT)
-			if err != nil {
-				return fmt.Errorf("Failed to set order status")
-			}
-			return fmt.Errorf("User has insufficient funds. cost: %d, balance: %d", totalCost, usr.Balance)
+			failStatus = order.PAYMENT_FAIL_INSUFFICIENT
+			return NewBusinessError(fmt.Errorf("User has insufficient funds. cost: %d, balance: %d", totalCost, usr.Balance))
+		}
+
+		// Last chance to abort before the charge is committed.
+		if ctx.IsCancelled(p.OrderID) {
+			ctx.Span.AddEvent("Order cancelled, not charging")
+			return ErrOrderCancelled
+		}
+
+		// NOTE(Appy): A revert may have run first if this perform timed out.
+		charged, err := RecordCharge(tsx, p.OrderID)
+		if err != nil {
+			return err
+		}
+		if !charged {
+			ctx.Span.AddEvent("Order already charged, skipping")
+			return nil
 		}
 
 		ctx.Span.AddEvent("User has sufficient funds, deducting")
@@ -77,31 +101,64 @@ func Perform(p StepPayload, ctx *TaskContext) (err error) {
 			return fmt.Errorf("Failed to update user balance")
 		}
 
-		return nil
+		// Don't commit a charge for a task that was given up on.
+		return ctx.Ctx.Err()
 	})
 
 	if err != nil {
 		ctx.Span.AddEvent("Transaction error, rolling back")
-		RevertPrevious(p, map[string]interface{}{"order_id": p.OrderID}, ctx)
-		return err
-	}
 
-	nextPayload := map[string]interface{}{
-		"amount":   p.Amount,
-		"token_id": p.TokenID,
-		"username": p.Username,
-		"order_id": p.OrderID,
+		var errStatus error
+		if len(failStatus) > 0 {
+			if errStatus = ctx.OrderClient.SetFailed(ctx.TraceContext(), p.OrderID, failStatus); errStatus != nil {
+				errStatus = fmt.Errorf("Failed to set order status: %w", errStatus)
+			}
+		}
+
+		PublishPaymentEvent(p, ctx, events.PAYMENT_FAILED, total, err)
+		return errors.Join(err, errStatus, RevertPrevious(p, p.Message(), ctx))
 	}
 
 	ctx.Span.AddEvent("Successfully processed payment")
+	PublishPaymentEvent(p, ctx, events.PAYMENT_CHARGED, total, nil)
+
+	if ctx.Chaos.ShouldFailAfterCommit() {
+		err = fmt.Errorf("Chaos: failed after commit")
+		ctx.Span.AddEvent(err.Error())
+		return errors.Join(err, RevertSelf(p, ctx))
+	}
+
+	err = PerformNext(p, p.Message(), ctx)
 
-	return PerformNext(p, nextPayload, ctx)
+	// NOTE(Appy): Cancelled while handing off, the next step may have checked
+	// the flag before it was set. Compensate it too, then refund and
+	// compensate upstream.
+	if err == nil && ctx.IsCancelled(p.OrderID) {
+		ctx.Span.AddEvent("Order cancelled after handoff, compensating")
+		return errors.Join(ErrOrderCancelled, RevertNext(p, ctx), RevertSelf(p, ctx))
+	}
+
+	return err
 }
 
 func Revert(p StepPayload, ctx *TaskContext) error {
 	ctx.Span.AddEvent("Refunding payment")
 
-	err := ctx.GormClient.Transaction(func(tsx *gorm.DB) error {
+	// Set if this revert refunded the order.
+	var refunded *decimal.Decimal
+
+	err := ctx.Transaction(func(tsx *gorm.DB) error {
+
+		// NOTE(Appy): Reverts are retried, never refund the same order twice,
+		// nor an order this step never charged.
+		firstRefund, err := RecordRefund(tsx, p.OrderID)
+		if err != nil {
+			return fmt.Errorf("Failed to record refund: %w", err)
+		}
+		if !firstRefund {
+			ctx.Span.AddEvent("Order not charged or already refunded, skipping")
+			return nil
+		}
 
 		ctx.Span.AddEvent("Retrieving token info", trace.WithAttributes(attribute.Int("token_id", int(p.TokenID))))
 		tok, err := token.GetToken(tsx, p.TokenID)
@@ -124,17 +181,33 @@ func Revert(p StepPayload, ctx *TaskContext) error {
 		if err != nil {
 			return fmt.Errorf("Failed to update user balance")
 		}
+		refunded = &totalCost
+
+		if err := ctx.Ctx.Err(); err != nil {
+			return err
+		}
+
+		// Rolls back the refund, the revert is retried.
+		if ctx.Chaos.ShouldFailRevert() {
+			ctx.Span.AddEvent("Chaos: failing the revert")
+			return fmt.Errorf("Chaos: failed during revert")
+		}
 
 		return nil
 	})
 	if err != nil {
 		return err
 	}
-	previousPayload := map[string]interface{}{
-		"order_id": p.OrderID,
-	}
-
 	ctx.Span.AddEvent("Successfully refunded")
 
-	return RevertPrevious(p, previousPayload, ctx)
+	if refunded != nil {
+		PublishPaymentEvent(p, ctx, events.PAYMENT_REFUNDED, refunded, nil)
+	}
+
+	// NOTE(Appy): A failure here retries the whole revert, the refund is skipped.
+	return errors.Join(
+		ctx.OrderClient.SetRefunded(ctx.TraceContext(), p.OrderID),
+		RevertBranches(p, ctx),
+		RevertPrevious(p, p.Message(), ctx),
+	)
 }
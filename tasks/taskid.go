@@ -0,0 +1,33 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+)
+
+//----------------------------------------------
+// Deterministic task IDs.
+//---------------------------------------------
+
+// SagaKey identifies the saga the payload belongs to. Chained sagas have no
+// saga ID, the order ID is unique to them.
+func (p StepPayload) SagaKey() string {
+	if len(p.SagaID) > 0 {
+		return p.SagaID
+	}
+	return fmt.Sprintf("order-%d", p.OrderID)
+}
+
+// StepTaskID derives the task ID of a step from the saga, so a retried handler
+// enqueuing the same step twice is rejected by asynq.
+func StepTaskID(sagaKey string, queue string, action string) string {
+	return fmt.Sprintf("%s:%s:%s", sagaKey, queue, action)
+}
+
+// IsDuplicate reports whether the enqueue was rejected because the same task
+// was already enqueued, which is handled as a success.
+func IsDuplicate(err error) bool {
+	return errors.Is(err, asynq.ErrTaskIDConflict) || errors.Is(err, asynq.ErrDuplicateTask)
+}
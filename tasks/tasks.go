@@ -2,12 +2,13 @@ package tasks
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 
 	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/events"
 	"github.com/hibiken/asynq"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/codes"
@@ -30,7 +31,21 @@ const (
 )
 
 type SagaPayload struct {
-	FailTrigger string `json:"fail_trigger"` // Name of the service to fail.
+	FailTrigger string      `json:"fail_trigger"`    // Name of the service to fail.
+	Chaos       []ChaosSpec `json:"chaos,omitempty"` // Faults injected into the steps.
+
+	// Set by the orchestrator, empty when the steps are chained together.
+	SagaID     string `json:"-"` // Carried by the envelope.
+	ReplyQueue string `json:"reply_queue,omitempty"`
+	Attempt    int    `json:"attempt,omitempty"`
+
+	// End-to-end deadline of the saga, in unix milliseconds. Set when the saga starts.
+	Deadline int64 `json:"deadline,omitempty"`
+
+	// Fan-out compensation.
+	RevertedBy   string   `json:"reverted_by,omitempty"`   // Queue that asked for the revert.
+	Branches     []string `json:"branches,omitempty"`      // Branches to compensate on a self revert.
+	SkipPrevious bool     `json:"skip_previous,omitempty"` // Don't propagate the revert upstream.
 
 	// For Otel
 	TraceCarrier propagation.MapCarrier `json:"trace_carrier,omitempty"`
@@ -49,6 +64,7 @@ var (
 //---------------------------------------------------------------
 
 func fetchSpan(p *StepPayload, ctx context.Context, taskCtx *TaskContext, job string) {
+	taskCtx.Job = job
 
 	// Create the propagator.
 	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
@@ -79,68 +95,92 @@ func fetchSpan(p *StepPayload, ctx context.Context, taskCtx *TaskContext, job st
 func HandlePerformStepTask(ctx context.Context, t *asynq.Task) error {
 	taskContext := GetTaskContext(ctx)
 
-	var p StepPayload
-	if err := json.Unmarshal(t.Payload(), &p); err != nil {
-		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	p, err := DecodeStepPayload(t.Payload())
+	if err != nil {
+		return fmt.Errorf("DecodeStepPayload failed: %v: %w", err, asynq.SkipRetry)
 	}
 	log.Printf("Payload: %+v\n", p)
 
-	fetchSpan(&p, ctx, taskContext, "perform")
+	fetchSpan(&p, ctx, taskContext, PERFORM)
 	defer taskContext.Span.End()
+	taskContext.AddCircuitEvents()
+
+	// The expiry handler compensated it already.
+	if !taskContext.ClaimTask(ctx) {
+		taskContext.Span.AddEvent("Task already handled on expiry, skipping")
+		return nil
+	}
+
+	// The saga starts here if nobody set its deadline yet.
+	p.StartDeadline(taskContext.SagaTimeout)
+	if p.Expired() {
+		return RefuseExpired(p, taskContext)
+	}
+
+	ctx, cancel := p.WithDeadline(ctx)
+	defer cancel()
+	taskContext.Ctx = ctx
+
+	taskContext.Chaos = NewChaos(p, taskContext)
+	if err = taskContext.Chaos.Delay(ctx, taskContext); err != nil {
+		if p.Expired() {
+			return RefuseExpired(p, taskContext)
+		}
+		taskContext.TaskFailed(err)
+		return err
+	}
+
+	// The fallback decides what happens to a task the breaker rejected.
+	degraded := false
+	if taskContext.CircuitOpen {
+		switch taskContext.CircuitFallback {
+		case FALLBACK_DEFER:
+			if DeferPerform(p, taskContext) {
+				return nil
+			}
+		case FALLBACK_DEGRADE:
+			taskContext.Span.AddEvent("Circuit open, charging in degraded mode")
+			degraded = true
+		}
+	}
 
     // Immediately send back default response if CB is open
-    var err error
-    if taskContext.CircuitBreaker.IsState("open") {
+    if taskContext.CircuitOpen && !degraded {
         err = fmt.Errorf("Default response")
         taskContext.TaskFailed(err)
-        errStatus := SetOrderStatus(taskContext.OrderSvcAddr, p.OrderID, order.DEFAULT_RESPONSE)
+        errStatus := taskContext.OrderClient.SetFailed(taskContext.TraceContext(), p.OrderID, order.DEFAULT_RESPONSE)
         if errStatus != nil {
-            return fmt.Errorf("Failed to set order status")
+            errStatus = fmt.Errorf("Failed to set order status")
         }
 
-        previousPayload := map[string]interface{}{
-            "amount": p.Amount,
-            "username": p.Username,
-            "token_id": p.TokenID,
-            "order_id": p.OrderID,
-        }
-        RevertPrevious(p, previousPayload, taskContext)
-        return err
+        // NOTE(Appy): Always compensate, even if the order service is down.
+        PublishPaymentEvent(p, taskContext, events.PAYMENT_FAILED, nil, err)
+        return errors.Join(err, errStatus, RevertPrevious(p, p.Message(), taskContext))
     }
 
-	if p.FailTrigger == taskContext.ServerQueue {
+	if p.FailTrigger == taskContext.ServerQueue || taskContext.Chaos.ShouldFail() {
 		err = fmt.Errorf("Forced to fail")
+
+		// NOTE(Appy): The fail trigger is asked for by the request, chaos
+		// stands for a broken dependency.
+		if p.FailTrigger == taskContext.ServerQueue {
+			err = NewBusinessError(err)
+		}
 		taskContext.TaskFailed(err)
-		errStatus := SetOrderStatus(taskContext.OrderSvcAddr, p.OrderID, order.FORCED_FAIL)
+		errStatus := taskContext.OrderClient.SetFailed(taskContext.TraceContext(), p.OrderID, order.FORCED_FAIL)
 		if errStatus != nil {
-			return fmt.Errorf("Failed to set order status")
+			errStatus = fmt.Errorf("Failed to set order status")
 		}
-        
-        previousPayload := map[string]interface{}{
-            "amount": p.Amount,
-            "username": p.Username,
-            "token_id": p.TokenID,
-            "order_id": p.OrderID,
-        }
-		RevertPrevious(p, previousPayload, taskContext)
-		return err
-	}
-
-	// Error channel. This can either catch context cancellation or if an error occured within the task.
-	c := make(chan error, 1)
 
-	// ctx = context.WithValue(ctx)
-
-	go func() {
-		c <- Perform(p, taskContext)
-	}()
+		PublishPaymentEvent(p, taskContext, events.PAYMENT_FAILED, nil, err)
+		return errors.Join(err, errStatus, RevertPrevious(p, p.Message(), taskContext))
+	}
 
-	select {
-	case <-ctx.Done():
-		// cancelation signal received, abandon this work.
-		err = ctx.Err()
-	case res := <-c:
-		err = res
+	// NOTE(Appy): Perform returns as soon as the context is done, nothing it
+	// started may outlive the task.
+	err = Perform(p, taskContext)
+	if err != nil && ctx.Err() != nil && p.Expired() {
+		err = errors.Join(ErrSagaExpired, err)
 	}
 
 	if err != nil {
@@ -155,31 +195,26 @@ func HandlePerformStepTask(ctx context.Context, t *asynq.Task) error {
 func HandleRevertStepTask(ctx context.Context, t *asynq.Task) error {
 	taskContext := GetTaskContext(ctx)
 
-	var p StepPayload
-	if err := json.Unmarshal(t.Payload(), &p); err != nil {
-		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	p, err := DecodeStepPayload(t.Payload())
+	if err != nil {
+		return fmt.Errorf("DecodeStepPayload failed: %v: %w", err, asynq.SkipRetry)
 	}
 	log.Printf("Payload: %+v\n", p)
 
-	fetchSpan(&p, ctx, taskContext, "revert")
+	fetchSpan(&p, ctx, taskContext, REVERT)
 	defer taskContext.Span.End()
+	taskContext.AddCircuitEvents()
+	taskContext.Ctx = ctx
 
-	// Error channel. This can either catch context cancellation or if an error occured within the task.
-	c := make(chan error, 1)
-
-	go func() {
-		c <- Revert(p, taskContext)
-	}()
-
-	var err error
-	select {
-	case <-ctx.Done():
-		// cancelation signal received, abandon this work.
-		err = ctx.Err()
-	case res := <-c:
-		err = res
+	taskContext.Chaos = NewChaos(p, taskContext)
+	if err = taskContext.Chaos.Delay(ctx, taskContext); err != nil {
+		taskContext.TaskFailed(err)
+		return err
 	}
 
+	// A cancelled revert is rolled back and retried.
+	err = Revert(p, taskContext)
+
 	taskContext.AddSpanStateEvent()
 
 	if err != nil {
@@ -8,4 +8,5 @@ func RegisterTopic(mux *asynq.ServeMux) {
 	// Register tasks here...
 	mux.HandleFunc("task:perform", HandlePerformStepTask)
 	mux.HandleFunc("task:revert", HandleRevertStepTask)
+	mux.HandleFunc("task:cancel", HandleCancelTask)
 }
@@ -1,17 +1,19 @@
 package tasks
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"time"
 
-	"github.com/alex-appy-love-story/db-lib/models/order"
+	"github.com/alex-appy-love-story/worker-template/bulkhead"
 	"github.com/alex-appy-love-story/worker-template/circuitbreaker"
+	"github.com/alex-appy-love-story/worker-template/events"
+	"github.com/alex-appy-love-story/worker-template/ordersvc"
+	"github.com/alex-appy-love-story/worker-template/webhooks"
 	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
@@ -31,16 +33,36 @@ const (
 )
 
 type TaskContext struct {
-	GormClient     *gorm.DB
-	AsynqClient    *asynq.Client
-	AsynqInspector *asynq.Inspector
-	NextQueue      string
-	ServerQueue    string
-	PreviousQueue  string
-	CircuitBreaker *circuitbreaker.CB
-	OrderSvcAddr   string
-	Span           trace.Span
-	TaskState      TaskState
+	// Ctx is done once asynq gives up on the task. Compensations and status
+	// updates are not bound to it, they must go through even then.
+	Ctx context.Context
+
+	GormClient      *gorm.DB
+	AsynqClient     *asynq.Client
+	AsynqInspector  *asynq.Inspector
+	RedisClient     *redis.Client
+	NextQueue       string
+	NextQueues      []string
+	ServerQueue     string
+	PreviousQueue   string
+	Breakers        *circuitbreaker.Registry
+	Bulkheads       *bulkhead.Registry
+	CircuitOpen     bool                        // The database breaker rejected the task.
+	CircuitChanges  []circuitbreaker.Transition // Made by the database breaker when admitting the task.
+	Admission       *Admission                  // Of the task by the database breaker.
+	CircuitFallback string                      // What to do with a rejected task, FALLBACK_XXX.
+	OrderClient     ordersvc.OrderClient
+	EventPublisher  *events.Publisher
+	Webhooks        *webhooks.Dispatcher
+	Span            trace.Span
+	TaskState       TaskState
+	Job             string // PERFORM or REVERT.
+	SagaTimeout     time.Duration
+	ContentType     string
+	SchemaVersion   int // Of the envelopes sent, SCHEMA_XXX.
+	DeadLetterQueue string
+	ChaosSpec       *ChaosSpec // Set on the service.
+	Chaos           *Chaos     // Resolved for the running step.
 }
 
 func (t TaskContext) TaskFailed(err error) {
@@ -48,6 +70,42 @@ func (t TaskContext) TaskFailed(err error) {
 	t.Span.SetStatus(codes.Error, err.Error())
 }
 
+// QueueBreaker is the breaker of the next queue.
+func (t TaskContext) QueueBreaker() *circuitbreaker.CB {
+	return t.Breakers.Get(circuitbreaker.QueueBreaker(t.NextQueue))
+}
+
+// Transaction runs f in a database transaction bound to Ctx, holding one of
+// the database slots. The outcome of the first one is reported to the
+// database breaker if the task was admitted, only infrastructure errors count.
+func (t TaskContext) Transaction(f func(tsx *gorm.DB) error) error {
+	ran := false
+	start := time.Now()
+	err := t.Bulkheads.Get(bulkhead.DATABASE).Do(t.Ctx, func() error {
+		ran = true
+		return t.GormClient.WithContext(t.Ctx).Transaction(f)
+	})
+
+	if ran && t.Admission.report() {
+		t.Breakers.Get(circuitbreaker.DATABASE).ReportContext(t.TraceContext(), !IsInfrastructureError(err), time.Since(start))
+	}
+	return err
+}
+
+// TraceContext carries the span of the task, for calls to other services.
+func (t TaskContext) TraceContext() context.Context {
+	return trace.ContextWithSpan(context.Background(), t.Span)
+}
+
+// AddCircuitEvents adds what the database breaker did when admitting the
+// task to its span. The span doesn't exist yet in the middleware.
+func (t TaskContext) AddCircuitEvents() {
+	circuitbreaker.AddTransitionEvents(t.Span, circuitbreaker.DATABASE, t.CircuitChanges)
+	if t.CircuitOpen {
+		circuitbreaker.AddRejectedEvent(t.Span, t.Breakers.Get(circuitbreaker.DATABASE))
+	}
+}
+
 func (t TaskContext) AddSpanStateEvent() {
 	switch t.TaskState {
 	case Expired:
@@ -62,7 +120,7 @@ func (t TaskContext) AddSpanStateEvent() {
 }
 
 func GetTaskContext(ctx context.Context) *TaskContext {
-	taskCtx := &TaskContext{}
+	taskCtx := &TaskContext{Ctx: ctx, SchemaVersion: SCHEMA_V0}
 
 	taskCtx.GormClient = nil
 	taskCtx.AsynqClient = nil
@@ -75,6 +133,10 @@ func GetTaskContext(ctx context.Context) *TaskContext {
 		taskCtx.AsynqInspector = val.(*asynq.Inspector)
 	}
 
+	if val := ctx.Value("redis_client"); val != nil {
+		taskCtx.RedisClient = val.(*redis.Client)
+	}
+
 	if val := ctx.Value("db_client"); val != nil {
 		taskCtx.GormClient = val.(*gorm.DB)
 	}
@@ -83,6 +145,10 @@ func GetTaskContext(ctx context.Context) *TaskContext {
 		taskCtx.NextQueue = val.(string)
 	}
 
+	if val := ctx.Value("next_queues"); val != nil {
+		taskCtx.NextQueues = val.([]string)
+	}
+
 	if val := ctx.Value("previous_queue"); val != nil {
 		taskCtx.PreviousQueue = val.(string)
 	}
@@ -91,16 +157,60 @@ func GetTaskContext(ctx context.Context) *TaskContext {
 		taskCtx.ServerQueue = val.(string)
 	}
 
-	if val := ctx.Value("circuit_breaker"); val != nil {
-		taskCtx.CircuitBreaker = val.(*circuitbreaker.CB)
+	if val := ctx.Value("circuit_breakers"); val != nil {
+		taskCtx.Breakers = val.(*circuitbreaker.Registry)
+	}
+
+	if val := ctx.Value("bulkheads"); val != nil {
+		taskCtx.Bulkheads = val.(*bulkhead.Registry)
+	}
+
+	if val := ctx.Value("circuit_open"); val != nil {
+		taskCtx.CircuitOpen = val.(bool)
+	}
+
+	if val := ctx.Value("circuit_changes"); val != nil {
+		taskCtx.CircuitChanges = val.([]circuitbreaker.Transition)
+	}
+
+	if val := ctx.Value("circuit_admission"); val != nil {
+		taskCtx.Admission = val.(*Admission)
+	}
+
+	if val := ctx.Value("circuit_fallback"); val != nil {
+		taskCtx.CircuitFallback = val.(string)
+	}
+
+	if val := ctx.Value("order_client"); val != nil {
+		taskCtx.OrderClient = val.(ordersvc.OrderClient)
+	}
+
+	if val := ctx.Value("event_publisher"); val != nil {
+		taskCtx.EventPublisher = val.(*events.Publisher)
+	}
+
+	if val := ctx.Value("webhook_dispatcher"); val != nil {
+		taskCtx.Webhooks = val.(*webhooks.Dispatcher)
+	}
+
+	if val := ctx.Value("content_type"); val != nil {
+		taskCtx.ContentType = val.(string)
+	}
+
+	if val := ctx.Value("schema_version"); val != nil {
+		taskCtx.SchemaVersion = val.(int)
+	}
+
+	if val := ctx.Value("dead_letter_queue"); val != nil {
+		taskCtx.DeadLetterQueue = val.(string)
 	}
 
-	if val := ctx.Value("circuit_breaker"); val != nil {
-		taskCtx.CircuitBreaker = val.(*circuitbreaker.CB)
+	if val := ctx.Value("saga_timeout"); val != nil {
+		taskCtx.SagaTimeout = val.(time.Duration)
 	}
 
-	if val := ctx.Value("order_svc_addr"); val != nil {
-		taskCtx.OrderSvcAddr = val.(string)
+	if val := ctx.Value("chaos_spec"); val != nil {
+		taskCtx.ChaosSpec = val.(*ChaosSpec)
 	}
 
 	return taskCtx
@@ -108,32 +218,52 @@ func GetTaskContext(ctx context.Context) *TaskContext {
 
 func GetTaskState(doIn time.Duration, taskID string, ctx *TaskContext) (TaskState, error) {
 
-	time.Sleep(doIn)
+	// Cancelled while waiting: a task nobody picked up yet is deleted below,
+	// the handoff is aborted.
+	select {
+	case <-ctx.Ctx.Done():
+		ctx.Span.AddEvent("Task cancelled, aborting the handoff")
+	case <-time.After(doIn):
+	}
+
+	queueBreaker := ctx.QueueBreaker()
+	traceCtx := ctx.TraceContext()
 
-	taskInfo, err := ctx.AsynqInspector.GetTaskInfo(ctx.NextQueue, taskID)
+	var taskInfo *asynq.TaskInfo
+	err := ctx.Bulkheads.Get(bulkhead.INSPECTOR).Do(traceCtx, func() (err error) {
+		taskInfo, err = ctx.AsynqInspector.GetTaskInfo(ctx.NextQueue, taskID)
+		return err
+	})
 
 	if err != nil {
 		if err.Error() == TASK_NOT_FOUND {
 			// Task no longer inside the current server queue. (It was taken)
+			queueBreaker.ReportContext(traceCtx, true, 0)
 			return Done, nil
+		} else if errors.Is(err, bulkhead.ErrFull) {
+			// NOTE(Appy): Too many polls in flight, the state of the next step
+			// is unknown. Handled like a failure, the next step compensates us
+			// if it fails.
+			return Failed, err
 		} else {
 			// Some error occured inside the task.
-			ctx.CircuitBreaker.IncrementFails()
-			return Failed, fmt.Errorf(taskInfo.LastErr)
+			queueBreaker.ReportContext(traceCtx, false, 0)
+			return Failed, err
 		}
 
 	} else {
 		if taskInfo.State.String() == "active" {
 			fmt.Println("Job is being processed.")
+			queueBreaker.ReportContext(traceCtx, true, 0)
 			return Done, nil
 		} else if taskInfo.State.String() == "archived" {
 			fmt.Println("Task failed!")
-			ctx.CircuitBreaker.IncrementFails()
+			queueBreaker.ReportContext(traceCtx, false, 0)
 			ctx.AsynqInspector.DeleteTask(ctx.NextQueue, taskID)
 			return Failed, fmt.Errorf(taskInfo.LastErr)
 		} else {
 			fmt.Println("Job is still in the queue. Cancel!", taskID)
-			ctx.CircuitBreaker.IncrementFails()
+			queueBreaker.ReportContext(traceCtx, false, 0)
 			err = ctx.AsynqInspector.DeleteTask(ctx.NextQueue, taskID)
 
 			if err != nil {
@@ -146,35 +276,73 @@ func GetTaskState(doIn time.Duration, taskID string, ctx *TaskContext) (TaskStat
 	}
 }
 
-func PerformNext(stepPayload StepPayload, payload map[string]interface{}, ctx *TaskContext) error {
-	payload["trace_carrier"] = stepPayload.TraceCarrier
-	payload["fail_trigger"] = stepPayload.FailTrigger
+func PerformNext(stepPayload StepPayload, body OrderMessage, ctx *TaskContext) error {
+	// NOTE(Appy): The orchestrator owns the handoff and the compensation.
+	if stepPayload.Orchestrated() {
+		if ctx.Chaos.ShouldDropHandoff() {
+			ctx.Span.AddEvent("Chaos: dropping the reply")
+			return nil
+		}
+		return SendReply(stepPayload, true, &body, ctx)
+	}
+
+	if len(ctx.NextQueues) > 1 {
+		return PerformFanOut(stepPayload, body, ctx)
+	}
+
+	// Last step, the saga is complete.
+	if len(ctx.NextQueue) == 0 {
+		// NOTE(Appy): The charge is committed, failing the task now would
+		// retry it and count against the breakers.
+		if err := ctx.OrderClient.SetSucceeded(ctx.TraceContext(), stepPayload.OrderID); err != nil {
+			log.Printf("Order %d: failed to set order status: %s\n", stepPayload.OrderID, err)
+			ctx.Span.RecordError(err)
+		}
+		return nil
+	}
 
-	p, err := json.Marshal(payload)
+	task, err := NewStepTask("task:perform", stepPayload.SagaID, body, ctx)
 	if err != nil {
 		fmt.Println("Failed to marshal")
-		RevertSelf(stepPayload, ctx)
-		return err
+		return errors.Join(err, RevertSelf(stepPayload, ctx))
+	}
+
+	// Never hand off a task that was given up on.
+	if err := ctx.Ctx.Err(); err != nil {
+		return errors.Join(err, RevertSelf(stepPayload, ctx))
 	}
 
-	task := asynq.NewTask("task:perform", p, asynq.MaxRetry(0))
+	taskID := StepTaskID(stepPayload.SagaKey(), ctx.NextQueue, PERFORM)
+
+	// NOTE(Appy): Nobody is taking tasks from the next queue, don't wait for the timeout.
+	if !ctx.QueueBreaker().AllowContext(ctx.TraceContext()) {
+		if ctx.CircuitFallback == FALLBACK_DEGRADE && ParkHandoff(stepPayload, task, taskID, ctx) {
+			return nil
+		}
+		err := fmt.Errorf("Circuit open for %s", ctx.NextQueue)
+		return errors.Join(err, RevertSelf(stepPayload, ctx))
+	}
 
 	// Process the task immediately.
-	taskInfo, err := ctx.AsynqClient.Enqueue(task, asynq.Queue(ctx.NextQueue), asynq.MaxRetry(0))
-	if err != nil {
+	opts := append(stepPayload.DeadlineOptions(), asynq.Queue(ctx.NextQueue), asynq.MaxRetry(0), asynq.TaskID(taskID))
+	opts = append(opts, ctx.Chaos.HandoffOptions(ctx)...)
+	_, err = ctx.AsynqClient.Enqueue(task, opts...)
+	if IsDuplicate(err) {
+		// NOTE(Appy): A previous attempt of this task already handed off, track that one.
+		log.Println("Task already enqueued to next:", taskID)
+	} else if err != nil {
 		fmt.Println("Failed to enqueue task to next")
-		RevertSelf(stepPayload, ctx)
-		return err
+		ctx.QueueBreaker().ReportContext(ctx.TraceContext(), false, 0)
+		return errors.Join(err, RevertSelf(stepPayload, ctx))
 	}
 
-	ctx.TaskState, err = GetTaskState(TIMEOUT, taskInfo.ID, ctx)
+	ctx.TaskState, err = GetTaskState(stepPayload.HandoffTimeout(), taskID, ctx)
 	ctx.AddSpanStateEvent()
 
 	switch ctx.TaskState {
 	case Expired:
 		// NOTE(Appy): The task is not taken. No servers taking the task.
-		RevertSelf(stepPayload, ctx)
-		fallthrough
+		return errors.Join(err, RevertSelf(stepPayload, ctx))
 	case Failed:
 		// NOTE(Appy): The next failed process would call revert on us.
 		return err
@@ -185,76 +353,71 @@ func PerformNext(stepPayload StepPayload, payload map[string]interface{}, ctx *T
 
 func RevertSelf(stepPayload StepPayload, ctx *TaskContext) error {
 	log.Printf("Calling revert self with payload: %+v\n", stepPayload)
-	p, err := json.Marshal(stepPayload)
+	body := stepPayload.Message()
+	body.RevertedBy = ctx.ServerQueue
+	body.Branches = stepPayload.Branches
 
+	task, err := NewStepTask("task:revert", stepPayload.SagaID, body, ctx)
 	if err != nil {
 		return err
 	}
 
-	task := asynq.NewTask("task:revert", p, asynq.MaxRetry(0))
-
 	// Process the task immediately.
-	_, err = ctx.AsynqClient.Enqueue(task, asynq.Queue(ctx.ServerQueue), asynq.MaxRetry(0))
-	if err != nil {
-
-		// Failed to queue.
-		return err
-	}
-
-	return nil
+	return EnqueueCompensation(task, ctx.ServerQueue, StepTaskID(stepPayload.SagaKey(), ctx.ServerQueue, REVERT), ctx)
 }
 
-func RevertPrevious(stepPayload StepPayload, payload map[string]interface{}, ctx *TaskContext) error {
-	if len(ctx.PreviousQueue) == 0 {
+// RevertNext compensates the steps this one handed off to, they may have
+// charged before the order was cancelled. They don't propagate the revert
+// upstream, this step does.
+func RevertNext(stepPayload StepPayload, ctx *TaskContext) error {
+	if stepPayload.Orchestrated() {
 		return nil
 	}
 
-	payload["trace_carrier"] = stepPayload.TraceCarrier
-	p, err := json.Marshal(payload)
-
-	if err != nil {
-		return err
+	queues := ctx.NextQueues
+	if len(queues) == 0 && len(ctx.NextQueue) > 0 {
+		queues = []string{ctx.NextQueue}
 	}
 
-	task := asynq.NewTask("task:revert", p, asynq.MaxRetry(0))
+	body := stepPayload.Message()
+	body.RevertedBy = ctx.ServerQueue
+	body.SkipPrevious = true
 
-	// Process the task immediately.
-	_, err = ctx.AsynqClient.Enqueue(task, asynq.Queue(ctx.PreviousQueue), asynq.MaxRetry(0))
+	task, err := NewStepTask("task:revert", stepPayload.SagaID, body, ctx)
 	if err != nil {
-
-		// Failed to queue.
 		return err
 	}
 
-	return nil
-}
+	var errs error
+	for _, queue := range queues {
+		ctx.Span.AddEvent(fmt.Sprintf("Compensating %s", queue))
+		taskID := StepTaskID(stepPayload.SagaKey(), queue, REVERT)
+		if err := EnqueueCompensation(task, queue, taskID, ctx); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
 
-func SetOrderStatus(orderSvcAddr string, orderID uint, status order.OrderStatus) error {
-	// Create client.
-	client := &http.Client{}
-	requestURL := fmt.Sprintf("http://%s/fail/%d", orderSvcAddr, orderID)
+	return errs
+}
 
-	payloadBuf := new(bytes.Buffer)
-	if err := json.NewEncoder(payloadBuf).Encode(map[string]interface{}{
-		"order_status": status,
-	}); err != nil {
-		return err
+func RevertPrevious(stepPayload StepPayload, body OrderMessage, ctx *TaskContext) error {
+	// A finished revert is a success, anything else means the perform failed.
+	if stepPayload.Orchestrated() {
+		return SendReply(stepPayload, ctx.Job == REVERT, nil, ctx)
 	}
 
-	// Set up request.
-	req, err := http.NewRequest("PUT", requestURL, payloadBuf)
-	if err != nil {
-		fmt.Printf("error making http request: %s\n", err)
-		return err
+	// Compensating a single branch of a fan-out, the step that fanned out handles the rest.
+	if len(ctx.PreviousQueue) == 0 || stepPayload.SkipPrevious {
+		return nil
 	}
 
-	// Fetch Request.
-	resp, err := client.Do(req)
+	body.RevertedBy = ctx.ServerQueue
+
+	task, err := NewStepTask("task:revert", stepPayload.SagaID, body, ctx)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
-	defer resp.Body.Close()
 
-	return nil
+	// Process the task immediately.
+	return EnqueueCompensation(task, ctx.PreviousQueue, StepTaskID(stepPayload.SagaKey(), ctx.PreviousQueue, REVERT), ctx)
 }
@@ -0,0 +1,88 @@
+package webhooks
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DELIVERY_PENDING   = "pending"
+	DELIVERY_SUCCEEDED = "succeeded"
+	DELIVERY_FAILED    = "failed"
+)
+
+// Endpoint is a partner URL the payment events are posted to.
+type Endpoint struct {
+	gorm.Model
+
+	URL    string `json:"url"`
+	Secret string `json:"-"`      // Signs the deliveries.
+	Events string `json:"events"` // Comma separated event types, empty for every event.
+	Active bool   `json:"active" gorm:"default:true"`
+}
+
+// Subscribed reports whether the endpoint wants the event type.
+func (e Endpoint) Subscribed(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+
+	for _, t := range strings.Split(e.Events, ",") {
+		if strings.TrimSpace(t) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery logs an event posted to an endpoint.
+type Delivery struct {
+	gorm.Model
+
+	EndpointID uint   `json:"endpoint_id" gorm:"uniqueIndex:idx_delivery_event"`
+	EventID    string `json:"event_id" gorm:"uniqueIndex:idx_delivery_event;size:191"`
+	EventType  string `json:"event_type"`
+	Payload    []byte `json:"payload"`
+
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+func CreateEndpoint(db *gorm.DB, url string, secret string, events string) (*Endpoint, error) {
+	endpoint := &Endpoint{URL: url, Secret: secret, Events: events, Active: true}
+	return endpoint, db.Create(endpoint).Error
+}
+
+func ListEndpoints(db *gorm.DB) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	err := db.Find(&endpoints).Error
+	return endpoints, err
+}
+
+func SetEndpointActive(db *gorm.DB, endpointID uint, active bool) error {
+	return db.Model(&Endpoint{}).Where("id = ?", endpointID).Update("active", active).Error
+}
+
+func GetDelivery(db *gorm.DB, deliveryID uint) (*Delivery, error) {
+	delivery := &Delivery{}
+	err := db.First(delivery, deliveryID).Error
+	return delivery, err
+}
+
+// ListDeliveries returns the latest deliveries, with the given status if set.
+func ListDeliveries(db *gorm.DB, status string, limit int) ([]Delivery, error) {
+	var deliveries []Delivery
+
+	query := db.Order("id desc").Limit(limit)
+	if len(status) > 0 {
+		query = query.Where(&Delivery{Status: status})
+	}
+
+	err := query.Find(&deliveries).Error
+	return deliveries, err
+}
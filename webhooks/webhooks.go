@@ -0,0 +1,262 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alex-appy-love-story/worker-template/events"
+	"github.com/hibiken/asynq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Retries of a delivery, asynq backs off between them.
+	DELIVERY_MAX_RETRY = 12
+	DELIVERY_TIMEOUT   = 10 * time.Second
+
+	// Error bodies are truncated to this size in the delivery log.
+	MAX_ERROR_BODY = 512
+
+	HEADER_DELIVERY  = "X-Webhook-Delivery"
+	HEADER_EVENT     = "X-Webhook-Event"
+	HEADER_TIMESTAMP = "X-Webhook-Timestamp"
+
+	// HEADER_SIGNATURE is "sha256=" followed by the hex HMAC-SHA256 of
+	// "<timestamp>.<body>", keyed with the secret of the endpoint.
+	HEADER_SIGNATURE = "X-Webhook-Signature"
+)
+
+type deliverPayload struct {
+	DeliveryID   uint                   `json:"delivery_id"`
+	TraceCarrier propagation.MapCarrier `json:"trace_carrier,omitempty"`
+}
+
+// Dispatcher fans the payment events out to the endpoints and delivers them.
+type Dispatcher struct {
+	db     *gorm.DB
+	client *asynq.Client
+	queue  string
+	http   *http.Client
+}
+
+func NewDispatcher(db *gorm.DB, client *asynq.Client, queue string) *Dispatcher {
+	return &Dispatcher{
+		db:     db,
+		client: client,
+		queue:  queue,
+		http:   &http.Client{Timeout: DELIVERY_TIMEOUT},
+	}
+}
+
+func (d *Dispatcher) RegisterTopic(mux *asynq.ServeMux) {
+	mux.HandleFunc("webhook:deliver", d.HandleDeliverTask)
+}
+
+// Transaction runs the queries of f in a transaction, see TaskContext.Transaction.
+type Transaction func(f func(tx *gorm.DB) error) error
+
+// Dispatch logs a delivery of the event for every subscribed endpoint and
+// enqueues them. An event dispatched twice is only delivered once. The
+// deliveries are logged through transaction, so the queries of a step hold
+// the same database slots and report to the same breaker as its others.
+func (d *Dispatcher) Dispatch(ctx context.Context, event events.PaymentEvent, transaction Transaction) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var deliveryIDs []uint
+	err = transaction(func(tx *gorm.DB) error {
+		var endpoints []Endpoint
+		if err := tx.Where(&Endpoint{Active: true}).Find(&endpoints).Error; err != nil {
+			return err
+		}
+
+		for _, endpoint := range endpoints {
+			if !endpoint.Subscribed(event.Type) {
+				continue
+			}
+
+			delivery := &Delivery{
+				EndpointID: endpoint.ID,
+				EventID:    event.ID,
+				EventType:  event.Type,
+				Payload:    payload,
+				Status:     DELIVERY_PENDING,
+			}
+
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(delivery)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				// Already dispatched.
+				continue
+			}
+
+			deliveryIDs = append(deliveryIDs, delivery.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// NOTE(Appy): Enqueued once committed, a delivery never runs before it is logged.
+	var errs error
+	for _, deliveryID := range deliveryIDs {
+		errs = errors.Join(errs, d.enqueue(ctx, deliveryID, asynq.TaskID(fmt.Sprintf("webhook:%d", deliveryID))))
+	}
+
+	return errs
+}
+
+// Replay delivers a logged delivery again, whatever its status.
+func (d *Dispatcher) Replay(ctx context.Context, deliveryID uint) error {
+	if _, err := GetDelivery(d.db, deliveryID); err != nil {
+		return err
+	}
+
+	if err := d.db.Model(&Delivery{}).Where("id = ?", deliveryID).Update("status", DELIVERY_PENDING).Error; err != nil {
+		return err
+	}
+
+	return d.enqueue(ctx, deliveryID)
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, deliveryID uint, opts ...asynq.Option) error {
+	p := deliverPayload{DeliveryID: deliveryID, TraceCarrier: make(propagation.MapCarrier)}
+	otel.GetTextMapPropagator().Inject(ctx, p.TraceCarrier)
+
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	opts = append(opts, asynq.Queue(d.queue), asynq.MaxRetry(DELIVERY_MAX_RETRY))
+	_, err = d.client.EnqueueContext(ctx, asynq.NewTask("webhook:deliver", payload), opts...)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	return err
+}
+
+func (d *Dispatcher) HandleDeliverTask(ctx context.Context, t *asynq.Task) error {
+	var p deliverPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+	ctx = otel.GetTextMapPropagator().Extract(ctx, p.TraceCarrier)
+
+	delivery, err := GetDelivery(d.db.WithContext(ctx), p.DeliveryID)
+	if err != nil {
+		return err
+	}
+
+	if delivery.Status == DELIVERY_SUCCEEDED {
+		return nil
+	}
+
+	endpoint := &Endpoint{}
+	if err := d.db.WithContext(ctx).First(endpoint, delivery.EndpointID).Error; err != nil {
+		return err
+	}
+
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	err = d.deliver(ctx, endpoint, delivery, retried >= maxRetry)
+
+	if errSave := d.db.WithContext(ctx).Save(delivery).Error; errSave != nil {
+		log.Println("Failed to log webhook delivery:", errSave)
+	}
+
+	return err
+}
+
+// deliver posts the delivery to the endpoint and records the outcome on it.
+// An error makes asynq retry the delivery, unless it wraps SkipRetry.
+func (d *Dispatcher) deliver(ctx context.Context, endpoint *Endpoint, delivery *Delivery, last bool) error {
+	statusCode, err := d.post(ctx, endpoint, delivery)
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+
+	switch {
+	case err == nil:
+		now := time.Now()
+		delivery.Status = DELIVERY_SUCCEEDED
+		delivery.DeliveredAt = &now
+	case !retryable(statusCode) || last:
+		delivery.Status = DELIVERY_FAILED
+		delivery.LastError = err.Error()
+		err = fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+	default:
+		delivery.LastError = err.Error()
+	}
+
+	return err
+}
+
+// post returns the status code of the endpoint, 0 if it didn't answer.
+func (d *Dispatcher) post(ctx context.Context, endpoint *Endpoint, delivery *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HEADER_DELIVERY, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HEADER_EVENT, delivery.EventType)
+	req.Header.Set(HEADER_TIMESTAMP, timestamp)
+	req.Header.Set(HEADER_SIGNATURE, Sign(endpoint.Secret, timestamp, delivery.Payload))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, MAX_ERROR_BODY))
+	return resp.StatusCode, fmt.Errorf("Endpoint responded with %d: %s", resp.StatusCode, string(body))
+}
+
+// Sign is the signature partners check the deliveries with.
+func Sign(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryable reports whether the endpoint may accept the delivery later. A
+// client error other than a timeout or a rate limit won't go away.
+func retryable(statusCode int) bool {
+	if statusCode >= 400 && statusCode < 500 {
+		return statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/hibiken/asynq"
+)
+
+func TestSign(t *testing.T) {
+	got := Sign("whsec_test", "1700000000", []byte(`{"id":"payment.charged:saga-42"}`))
+	want := "sha256=5d2720c4990b9b7efcd2512042d929a9df724dc35193bc36953d6d4e0da15002"
+	if got != want {
+		t.Errorf("signature %s, want %s", got, want)
+	}
+}
+
+// partner is an endpoint answering with the codes of fail before accepting the
+// deliveries, and checking their signature.
+type partner struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	fail     []int
+	requests int
+	invalid  []string
+}
+
+func newPartner(t *testing.T, fail ...int) *partner {
+	p := &partner{fail: fail}
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serve))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *partner) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.requests++
+	if got, want := r.Header.Get(HEADER_SIGNATURE), Sign("whsec_test", r.Header.Get(HEADER_TIMESTAMP), body); got != want {
+		p.invalid = append(p.invalid, got)
+	}
+	if r.Header.Get(HEADER_DELIVERY) != "7" || r.Header.Get(HEADER_EVENT) != "payment.charged" {
+		p.invalid = append(p.invalid, r.Header.Get(HEADER_DELIVERY)+" "+r.Header.Get(HEADER_EVENT))
+	}
+
+	if len(p.fail) > 0 {
+		code := p.fail[0]
+		p.fail = p.fail[1:]
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func testDelivery() *Delivery {
+	delivery := &Delivery{
+		EventID:   "payment.charged:saga-42",
+		EventType: "payment.charged",
+		Payload:   []byte(`{"id":"payment.charged:saga-42"}`),
+		Status:    DELIVERY_PENDING,
+	}
+	delivery.ID = 7
+	return delivery
+}
+
+func TestDeliverRetries(t *testing.T) {
+	p := newPartner(t, http.StatusServiceUnavailable)
+	d := NewDispatcher(nil, nil, "webhooks")
+	endpoint := &Endpoint{URL: p.URL, Secret: "whsec_test"}
+	delivery := testDelivery()
+
+	err := d.deliver(context.Background(), endpoint, delivery, false)
+	if err == nil || errors.Is(err, asynq.SkipRetry) {
+		t.Fatalf("first attempt: got %v, want a retry", err)
+	}
+	if delivery.Status != DELIVERY_PENDING || delivery.LastStatusCode != http.StatusServiceUnavailable {
+		t.Errorf("first attempt: %s with %d", delivery.Status, delivery.LastStatusCode)
+	}
+
+	if err := d.deliver(context.Background(), endpoint, delivery, false); err != nil {
+		t.Fatalf("second attempt: %v", err)
+	}
+	if delivery.Status != DELIVERY_SUCCEEDED || delivery.Attempts != 2 || delivery.LastError != "" || delivery.DeliveredAt == nil {
+		t.Errorf("second attempt: %+v", delivery)
+	}
+
+	if p.requests != 2 {
+		t.Errorf("posted %d times, want 2", p.requests)
+	}
+	if len(p.invalid) > 0 {
+		t.Errorf("invalid headers: %v", p.invalid)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		last bool
+	}{
+		{"client error", http.StatusBadRequest, false},
+		{"out of retries", http.StatusServiceUnavailable, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPartner(t, tt.code)
+			d := NewDispatcher(nil, nil, "webhooks")
+			delivery := testDelivery()
+
+			err := d.deliver(context.Background(), &Endpoint{URL: p.URL, Secret: "whsec_test"}, delivery, tt.last)
+			if !errors.Is(err, asynq.SkipRetry) {
+				t.Errorf("got %v, want a SkipRetry", err)
+			}
+			if delivery.Status != DELIVERY_FAILED || delivery.LastStatusCode != tt.code {
+				t.Errorf("%s with %d, want failed with %d", delivery.Status, delivery.LastStatusCode, tt.code)
+			}
+		})
+	}
+}